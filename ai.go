@@ -13,8 +13,52 @@ type (
 	CompletionRequest = sdk.CompletionRequest
 	Tool              = sdk.Tool
 	InputSchema       = sdk.InputSchema
+	ApprovalDecision  = sdk.ApprovalDecision
+	LoopState         = sdk.LoopState
+	Usage             = sdk.Usage
+	Reasoning         = sdk.Reasoning
+	Budget            = sdk.Budget
+	ModelPricing      = sdk.ModelPricing
+	RateLimiter       = sdk.RateLimiter
+	KeyPool           = sdk.KeyPool
+	StaticKeys        = sdk.StaticKeys
+	FileKeys          = sdk.FileKeys
+	MemoryCache       = sdk.MemoryCache
+	DiskCache         = sdk.DiskCache
+	Agent             = sdk.Agent
+	AgentStep         = sdk.AgentStep
+	AgentResult       = sdk.AgentResult
+	StopCondition     = sdk.StopCondition
+	TranscriptEntry   = sdk.TranscriptEntry
+	Document          = sdk.Document
+	Citation          = sdk.Citation
+	SafetyRating      = sdk.SafetyRating
 )
 
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	return sdk.NewRateLimiter(requestsPerMinute, tokensPerMinute)
+}
+
+func NewKeyPool(source sdk.CredentialProvider, selection sdk.KeySelection) *KeyPool {
+	return sdk.NewKeyPool(source, selection)
+}
+
+func NewMemoryCache(capacity int) *MemoryCache {
+	return sdk.NewMemoryCache(capacity)
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	return sdk.NewDiskCache(dir)
+}
+
+func MaxSteps(n int) StopCondition {
+	return sdk.MaxSteps(n)
+}
+
+func ToolCalled(name string) StopCondition {
+	return sdk.ToolCalled(name)
+}
+
 func Anannas(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewAnannasProvider(apiKey))
 }
@@ -23,10 +67,28 @@ func Anthropic(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewAnthropicProvider(apiKey))
 }
 
+func AzureOpenAI(endpoint, apiKey string) *SDK {
+	return sdk.NewSDK(providers.NewAzureOpenAIProvider(endpoint, apiKey))
+}
+
+// signs requests with the AWS_* environment credentials, an empty region uses AWS_REGION
+func Bedrock(region string) *SDK {
+	return sdk.NewSDK(providers.NewBedrockProvider(region))
+}
+
+func Cohere(apiKey string) *SDK {
+	return sdk.NewSDK(providers.NewCohereProvider(apiKey))
+}
+
 func Gemini(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewGeminiProvider(apiKey))
 }
 
+// Gemini on Vertex AI, tokens supplies OAuth access tokens, e.g. a providers.GoogleServiceAccount
+func GeminiVertex(project, location string, tokens sdk.TokenSource) *SDK {
+	return sdk.NewSDK(providers.NewGeminiVertexProvider(project, location, tokens))
+}
+
 func GroqCloud(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewGroqCloudProvider(apiKey))
 }
@@ -35,10 +97,20 @@ func Mistral(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewMistralProvider(apiKey))
 }
 
+// connects to an Ollama server, an empty baseURL uses http://localhost:11434
+func Ollama(baseURL string) *SDK {
+	return sdk.NewSDK(providers.NewOllamaProvider(baseURL))
+}
+
 func OpenAi(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewOpenAiProvider(apiKey))
 }
 
+// any API following the OpenAI chat completions format, e.g. vLLM, llama.cpp server, LM Studio, Together, Fireworks or DeepSeek
+func OpenAICompatible(config providers.OpenAICompatibleConfig, apiKey string) *SDK {
+	return sdk.NewSDK(providers.NewOpenAICompatibleProvider(config, apiKey))
+}
+
 func OpenRouter(apiKey string) *SDK {
 	return sdk.NewSDK(providers.NewOpenRouterProvider(apiKey))
 }
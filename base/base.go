@@ -4,14 +4,19 @@ package base
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/unsafe0x0/ai/v2/sdk"
 )
 
 type Provider struct {
 	APICaller
+	Name        string           // provider name, used for rate limit keys
+	RateLimiter *sdk.RateLimiter // optional client side rate limiter
+	KeyPool     *sdk.KeyPool     // optional pool of API keys used instead of the provider key
 }
 
 type APICaller interface {
@@ -22,6 +27,26 @@ type StreamParser interface {
 	ParseResponse(body io.Reader, onChunk func(string) error) error
 }
 
+// implemented by providers that stream more than content text, such as reasoning, tool calls and usage
+type EventStreamParser interface {
+	ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error
+}
+
+// adapts an event parser to a StreamParser by forwarding only the content text
+func ParseContent(parser EventStreamParser, body io.Reader, onChunk func(string) error) error {
+	return parser.ParseEvents(body, func(evt sdk.StreamEvent) error {
+		if evt.Content == "" {
+			return nil
+		}
+		return onChunk(evt.Content)
+	})
+}
+
+// implemented by providers whose non-streaming responses are not in the OpenAI format
+type CompletionParser interface {
+	ParseCompletion(body []byte) (*sdk.CompletionResponse, error)
+}
+
 // adds a system prompt to the beginning of the messages
 func (p *Provider) AddSystemPrompt(messages []sdk.Message, opts *sdk.Options) []sdk.Message {
 	if opts != nil && opts.SystemPrompt != "" {
@@ -32,6 +57,99 @@ func (p *Provider) AddSystemPrompt(messages []sdk.Message, opts *sdk.Options) []
 	return messages
 }
 
+type limitKey struct{}
+
+type apiKeyKey struct{}
+
+func (p *Provider) SetRateLimiter(limiter *sdk.RateLimiter) {
+	p.RateLimiter = limiter
+}
+
+func (p *Provider) SetKeyPool(pool *sdk.KeyPool) {
+	p.KeyPool = pool
+}
+
+// picks a key from the key pool and tags ctx with it
+func (p *Provider) acquireAPIKey(ctx context.Context) (context.Context, error) {
+	if p.KeyPool == nil {
+		return ctx, nil
+	}
+	key, err := p.KeyPool.Acquire(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, apiKeyKey{}, key), nil
+}
+
+// returns the key picked from the key pool for this call, or fallback when no pool is set
+func (p *Provider) ResolveAPIKey(ctx context.Context, fallback string) string {
+	if key, ok := ctx.Value(apiKeyKey{}).(string); ok {
+		return key
+	}
+	return fallback
+}
+
+// prepares ctx for a call to the API
+func (p *Provider) prepareCall(ctx context.Context, messages []sdk.Message, opts *sdk.Options) (context.Context, error) {
+	ctx, err := p.acquireAPIKey(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	return p.waitForRateLimit(ctx, messages, opts)
+}
+
+// blocks until the rate limiter allows the request and tags ctx with its key
+func (p *Provider) waitForRateLimit(ctx context.Context, messages []sdk.Message, opts *sdk.Options) (context.Context, error) {
+	if p.RateLimiter == nil {
+		return ctx, nil
+	}
+
+	key := p.Name
+	tokens := sdk.EstimateMessageTokens(messages)
+	if opts != nil {
+		key += ":" + opts.Model
+		tokens += opts.MaxCompletionTokens
+	}
+
+	if err := p.RateLimiter.Wait(ctx, key, tokens); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, limitKey{}, key), nil
+}
+
+// sends the request, feeds the response to the rate limiter and key pool and turns non 200 responses into an APIError,
+// credentials of the request never appear in the returned error
+func (p *Provider) Do(req *http.Request) (*http.Response, error) {
+	resp, err := p.do(req)
+	return resp, redactError(req, err)
+}
+
+func (p *Provider) do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := req.Context().Value(limitKey{}).(string); ok && p.RateLimiter != nil {
+		p.RateLimiter.Observe(key, resp)
+	}
+	if key, ok := req.Context().Value(apiKeyKey{}).(string); ok && p.KeyPool != nil {
+		p.KeyPool.Report(key, resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &sdk.APIError{
+			StatusCode: resp.StatusCode,
+			Message:    string(b),
+			Body:       b,
+		}
+	}
+
+	return resp, nil
+}
+
 // creates a completion by calling the API and processing the response
 func (p *Provider) CreateCompletion(
 	ctx context.Context,
@@ -40,6 +158,11 @@ func (p *Provider) CreateCompletion(
 ) (*sdk.CompletionResponse, error) {
 	messages = p.AddSystemPrompt(messages, opts)
 
+	ctx, err := p.prepareCall(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	body, err := p.CallAPI(ctx, messages, false, opts)
 	if err != nil {
 		return nil, err
@@ -51,7 +174,15 @@ func (p *Provider) CreateCompletion(
 		return nil, err
 	}
 
+	if parser, ok := p.APICaller.(CompletionParser); ok {
+		return parser.ParseCompletion(respBytes)
+	}
+
 	content, err := ExtractJsonResponse(respBytes)
+	var blocked *sdk.ContentBlockedError
+	if errors.As(err, &blocked) {
+		return nil, err
+	}
 	if err != nil {
 		return &sdk.CompletionResponse{
 			Content: string(respBytes),
@@ -69,31 +200,44 @@ func (p *Provider) CreateCompletionStream(
 ) (io.ReadCloser, error) {
 	messages = p.AddSystemPrompt(messages, opts)
 
+	ctx, err := p.prepareCall(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	body, err := p.CallAPI(ctx, messages, true, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	parser, ok := p.APICaller.(StreamParser)
-	if !ok {
+	var onReasoning func(string)
+	if opts != nil {
+		onReasoning = opts.OnReasoning
+	}
+
+	var parse func(onEvent func(sdk.StreamEvent) error) error
+	switch parser := p.APICaller.(type) {
+	case EventStreamParser:
+		parse = func(onEvent func(sdk.StreamEvent) error) error {
+			return parser.ParseEvents(body, onEvent)
+		}
+	case StreamParser:
+		parse = func(onEvent func(sdk.StreamEvent) error) error {
+			return parser.ParseResponse(body, func(chunk string) error {
+				return onEvent(sdk.StreamEvent{Content: chunk})
+			})
+		}
+	default:
 		body.Close()
 		return nil, fmt.Errorf("streaming not supported by this provider")
 	}
 
-	r, w := io.Pipe()
+	pipe := sdk.NewEventPipe(onReasoning)
 
 	go func() {
 		defer body.Close()
-		err := parser.ParseResponse(body, func(chunk string) error {
-			_, writeErr := w.Write([]byte(chunk))
-			return writeErr
-		})
-		if err != nil {
-			w.CloseWithError(err)
-		} else {
-			w.Close()
-		}
+		pipe.Finish(parse(pipe.Emit))
 	}()
 
-	return r, nil
+	return pipe, nil
 }
@@ -0,0 +1,42 @@
+package base_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/providers"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func TestRateLimitCountsPromptAndCompletionTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer server.Close()
+	useTransport(t, redirectTo(server))
+
+	p := providers.NewOpenAiProvider(secret)
+	p.SetRateLimiter(sdk.NewRateLimiter(0, 1000))
+	call := func(model string, maxTokens int) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		messages := []sdk.Message{{Role: "user", Content: "abcdefgh"}} // estimated at 6 tokens
+		_, err := p.CreateCompletion(ctx, messages, &sdk.Options{Model: model, MaxCompletionTokens: maxTokens})
+		return err
+	}
+
+	if err := call("m", 994); err != nil {
+		t.Fatal(err)
+	}
+	if err := call("m", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the request to wait for the tokens used by the prompt and max completion tokens", err)
+	}
+	if err := call("other", 994); err != nil {
+		t.Errorf("another model shares the limit: %v", err)
+	}
+}
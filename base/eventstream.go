@@ -0,0 +1,122 @@
+// decoding of the AWS event stream binary framing used by streaming AWS APIs
+
+package base
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// one frame of an event stream
+type EventStreamMessage struct {
+	Headers map[string]interface{} // string, bool, int and []byte values by header type
+	Payload []byte
+}
+
+// returns a string header, empty when missing or not a string
+func (m *EventStreamMessage) Header(name string) string {
+	s, _ := m.Headers[name].(string)
+	return s
+}
+
+// reads and checks one message, returns io.EOF when the stream ends between messages
+func ReadEventStreamMessage(r io.Reader) (*EventStreamMessage, error) {
+	// prelude: total length, headers length, prelude crc
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("event stream truncated in prelude")
+		}
+		return nil, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("event stream prelude checksum mismatch")
+	}
+	if totalLen < 16 || headersLen > totalLen-16 || totalLen > 16<<20 {
+		return nil, fmt.Errorf("event stream message has invalid length %d", totalLen)
+	}
+
+	rest := make([]byte, totalLen-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("event stream truncated in message: %w", err)
+	}
+
+	crc := crc32.ChecksumIEEE(prelude)
+	crc = crc32.Update(crc, crc32.IEEETable, rest[:len(rest)-4])
+	if crc != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+		return nil, fmt.Errorf("event stream message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(rest[:headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &EventStreamMessage{Headers: headers, Payload: rest[headersLen : len(rest)-4]}, nil
+}
+
+func parseEventStreamHeaders(b []byte) (map[string]interface{}, error) {
+	headers := map[string]interface{}{}
+	short := fmt.Errorf("event stream header truncated")
+
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, short
+		}
+		name := string(b[1 : 1+nameLen])
+		typ := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		var size int
+		switch typ {
+		case 0, 1: // bool true, bool false
+			headers[name] = typ == 0
+			continue
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // int
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 6, 7: // bytes, string
+			if len(b) < 2 {
+				return nil, short
+			}
+			size = 2 + int(binary.BigEndian.Uint16(b))
+		case 9: // uuid
+			size = 16
+		default:
+			return nil, fmt.Errorf("event stream header %s has unknown type %d", name, typ)
+		}
+		if len(b) < size {
+			return nil, short
+		}
+
+		v := b[:size]
+		switch typ {
+		case 2:
+			headers[name] = int(int8(v[0]))
+		case 3:
+			headers[name] = int(int16(binary.BigEndian.Uint16(v)))
+		case 4:
+			headers[name] = int(int32(binary.BigEndian.Uint32(v)))
+		case 5, 8:
+			headers[name] = int(int64(binary.BigEndian.Uint64(v)))
+		case 6:
+			headers[name] = append([]byte(nil), v[2:]...)
+		case 7:
+			headers[name] = string(v[2:])
+		case 9:
+			headers[name] = append([]byte(nil), v...)
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
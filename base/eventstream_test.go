@@ -0,0 +1,111 @@
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// frames a message with string headers the way AWS event streams do
+func encodeEventStreamMessage(headers [][2]string, payload []byte) []byte {
+	var hb bytes.Buffer
+	for _, h := range headers {
+		hb.WriteByte(byte(len(h[0])))
+		hb.WriteString(h[0])
+		hb.WriteByte(7)
+		binary.Write(&hb, binary.BigEndian, uint16(len(h[1])))
+		hb.WriteString(h[1])
+	}
+
+	total := 12 + hb.Len() + len(payload) + 4
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(total))
+	binary.Write(&msg, binary.BigEndian, uint32(hb.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hb.Bytes())
+	msg.Write(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func TestReadEventStreamMessages(t *testing.T) {
+	first := encodeEventStreamMessage([][2]string{{":event-type", "contentBlockDelta"}, {":message-type", "event"}}, []byte(`{"delta":{"text":"hi"}}`))
+	second := encodeEventStreamMessage(nil, nil)
+	r := bytes.NewReader(append(first, second...))
+
+	msg, err := ReadEventStreamMessage(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header(":event-type") != "contentBlockDelta" || msg.Header(":message-type") != "event" || string(msg.Payload) != `{"delta":{"text":"hi"}}` {
+		t.Errorf("first message = %+v", msg)
+	}
+
+	msg, err = ReadEventStreamMessage(r)
+	if err != nil || len(msg.Headers) != 0 || len(msg.Payload) != 0 {
+		t.Errorf("empty message = %+v, %v", msg, err)
+	}
+
+	if _, err := ReadEventStreamMessage(r); err != io.EOF {
+		t.Errorf("err at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadEventStreamHeaderTypes(t *testing.T) {
+	// a bool true header and an int header, which the encoder above does not write
+	headers := []byte{4, 'f', 'l', 'a', 'g', 0, 5, 'c', 'o', 'u', 'n', 't', 4, 0xff, 0xff, 0xff, 0xfe}
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(12+len(headers)+4))
+	binary.Write(&msg, binary.BigEndian, uint32(len(headers)))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(headers)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+
+	got, err := ReadEventStreamMessage(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Headers["flag"] != true || got.Headers["count"] != -2 {
+		t.Errorf("headers = %v", got.Headers)
+	}
+}
+
+func TestReadEventStreamRejectsBadFrames(t *testing.T) {
+	valid := encodeEventStreamMessage([][2]string{{":event-type", "messageStop"}}, []byte(`{}`))
+	corrupt := func(i int) []byte {
+		b := append([]byte(nil), valid...)
+		b[i] ^= 0xff
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  string
+	}{
+		{"prelude crc", corrupt(9), "prelude checksum mismatch"},
+		{"length", corrupt(2), "prelude checksum mismatch"},
+		{"payload", corrupt(len(valid) - 6), "message checksum mismatch"},
+		{"message crc", corrupt(len(valid) - 1), "message checksum mismatch"},
+		{"truncated prelude", valid[:8], "truncated in prelude"},
+		{"truncated message", valid[:len(valid)-3], "truncated in message"},
+	}
+	for _, tt := range tests {
+		_, err := ReadEventStreamMessage(bytes.NewReader(tt.frame))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// a prelude with a valid checksum but a length too short for the crc fields
+	var short bytes.Buffer
+	binary.Write(&short, binary.BigEndian, uint32(8))
+	binary.Write(&short, binary.BigEndian, uint32(0))
+	binary.Write(&short, binary.BigEndian, crc32.ChecksumIEEE(short.Bytes()))
+	if _, err := ReadEventStreamMessage(&short); err == nil || !strings.Contains(err.Error(), "invalid length") {
+		t.Errorf("short message: err = %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// shared helpers for providers using the OpenAI chat completions format
+
+package base
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+// converts sdk messages to OpenAI chat messages, including tool calls and tool results
+func OpenAiMessages(messages []sdk.Message) []map[string]interface{} {
+	chatMessages := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		msg := map[string]interface{}{
+			"role":    m.Role,
+			"content": m.Content,
+		}
+		if m.ToolCallID != "" {
+			msg["tool_call_id"] = m.ToolCallID
+		}
+		if len(m.ToolCalls) > 0 {
+			toolCalls := make([]map[string]interface{}, 0, len(m.ToolCalls))
+			for _, tc := range m.ToolCalls {
+				args := string(tc.Arguments)
+				if args == "" {
+					args = "{}"
+				}
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   tc.ID,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      tc.Name,
+						"arguments": args,
+					},
+				})
+			}
+			msg["tool_calls"] = toolCalls
+		}
+		chatMessages = append(chatMessages, msg)
+	}
+	return chatMessages
+}
+
+// converts sdk tools to OpenAI function tools sorted by name
+func OpenAiTools(tools map[string]sdk.Tool) []map[string]interface{} {
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		tool := tools[name]
+		out = append(out, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        name,
+				"description": tool.Description,
+				"parameters":  tool.Schema(),
+			},
+		})
+	}
+	return out
+}
+
+// maps a tool choice to the OpenAI tool_choice value
+func OpenAiToolChoice(choice string) interface{} {
+	switch choice {
+	case sdk.ToolChoiceAuto, sdk.ToolChoiceNone, sdk.ToolChoiceRequired:
+		return choice
+	default:
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": choice},
+		}
+	}
+}
+
+// adds tools, tool_choice and parallel_tool_calls to an OpenAI request body
+func ApplyOpenAiTools(body map[string]interface{}, opts *sdk.Options) {
+	if opts == nil || len(opts.Tools) == 0 {
+		return
+	}
+	body["tools"] = OpenAiTools(opts.Tools)
+	if opts.ToolChoice != "" {
+		body["tool_choice"] = OpenAiToolChoice(opts.ToolChoice)
+	}
+	if opts.ParallelToolCalls != nil {
+		body["parallel_tool_calls"] = *opts.ParallelToolCalls
+	}
+}
+
+// tool call in the OpenAI format, older responses put name and arguments at the top level
+type openAiToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Function  struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func (tc openAiToolCall) toSDK() sdk.ToolCallRequest {
+	name, args := tc.Function.Name, tc.Function.Arguments
+	if name == "" {
+		name, args = tc.Name, tc.Arguments
+	}
+	if args == "" {
+		args = "{}"
+	}
+	return sdk.ToolCallRequest{
+		ID:        tc.ID,
+		Name:      name,
+		Arguments: json.RawMessage(args),
+	}
+}
+
+// sets reasoning_effort from the reasoning configuration
+func ApplyReasoningEffort(body map[string]interface{}, r *sdk.Reasoning) {
+	body["reasoning_effort"] = r.EffortLevel()
+}
+
+// sets the reasoning object used by OpenRouter style gateways, a token budget takes precedence over effort
+func ApplyReasoningObject(body map[string]interface{}, r *sdk.Reasoning) {
+	reasoning := map[string]interface{}{}
+	if r.BudgetTokens > 0 {
+		reasoning["max_tokens"] = r.BudgetTokens
+	} else {
+		reasoning["effort"] = r.EffortLevel()
+	}
+	if r.Exclude {
+		reasoning["exclude"] = true
+	}
+	body["reasoning"] = reasoning
+}
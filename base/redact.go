@@ -0,0 +1,145 @@
+// keeps credentials out of errors returned by providers
+
+package base
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+const redacted = "REDACTED"
+
+// headers whose values are credentials
+var credentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"X-Amz-Security-Token",
+}
+
+// query parameters whose values are credentials
+var credentialParams = map[string]bool{
+	"key":          true,
+	"api_key":      true,
+	"api-key":      true,
+	"apikey":       true,
+	"access_token": true,
+	"token":        true,
+}
+
+// collects the credentials a request carries in its headers, query and URL user info
+func requestSecrets(req *http.Request) []string {
+	var secrets []string
+	add := func(s string) {
+		if len(s) >= 4 {
+			secrets = append(secrets, s)
+		}
+	}
+
+	for _, name := range credentialHeaders {
+		for _, v := range req.Header.Values(name) {
+			add(v)
+			// "Bearer <token>" and similar, the token alone may be echoed back
+			if _, token, ok := strings.Cut(v, " "); ok {
+				add(strings.TrimSpace(token))
+			}
+		}
+	}
+	for name, values := range req.URL.Query() {
+		if credentialParams[strings.ToLower(name)] {
+			for _, v := range values {
+				add(v)
+			}
+		}
+	}
+	if req.URL.User != nil {
+		if password, ok := req.URL.User.Password(); ok {
+			add(password)
+		}
+	}
+	// a key from the pool may travel in a header this file does not know
+	if key, ok := req.Context().Value(apiKeyKey{}).(string); ok {
+		add(key)
+	}
+	return secrets
+}
+
+// replaces every secret in s
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// returns u with credential query parameters and the password masked
+func redactURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		if _, ok := c.User.Password(); ok {
+			c.User = url.UserPassword(c.User.Username(), redacted)
+		}
+	}
+	query := c.Query()
+	changed := false
+	for name := range query {
+		if credentialParams[strings.ToLower(name)] {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		c.RawQuery = query.Encode()
+	}
+	return c.String()
+}
+
+// strips the credentials of req from an error returned while sending it or reading its response
+func redactError(req *http.Request, err error) error {
+	if err == nil {
+		return nil
+	}
+	secrets := requestSecrets(req)
+
+	var apiErr *sdk.APIError
+	if errors.As(err, &apiErr) {
+		apiErr.Message = redactSecrets(apiErr.Message, secrets)
+		apiErr.Body = []byte(redactSecrets(string(apiErr.Body), secrets))
+		return err
+	}
+
+	// the url error keeps its cause so errors.Is still sees timeouts and cancellation
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		cause := urlErr.Err
+		if msg := redactSecrets(cause.Error(), secrets); msg != cause.Error() {
+			cause = &redactedError{msg: msg, err: cause}
+		}
+		return &url.Error{Op: urlErr.Op, URL: redactURL(req.URL), Err: cause}
+	}
+
+	if msg := redactSecrets(err.Error(), secrets); msg != err.Error() {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// an error whose message had credentials removed, unwrapping to the original
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,141 @@
+package base_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/providers"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+const secret = "sk-test-0123456789abcdef"
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// sends every request made through http.DefaultClient to transport
+func useTransport(t *testing.T, transport http.RoundTripper) {
+	previous := http.DefaultClient.Transport
+	http.DefaultClient.Transport = transport
+	t.Cleanup(func() { http.DefaultClient.Transport = previous })
+}
+
+// redirects every request to server, keeping path and query
+func redirectTo(server *httptest.Server) http.RoundTripper {
+	target, _ := url.Parse(server.URL)
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+func keyedProviders() map[string]sdk.Provider {
+	bedrock := providers.NewBedrockProvider("us-east-1")
+	bedrock.Credentials = base.AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "unused-secret", SessionToken: secret}
+	ollama := providers.NewOllamaProvider("")
+	ollama.APIKey = secret
+
+	return map[string]sdk.Provider{
+		"anannas":    providers.NewAnannasProvider(secret),
+		"anthropic":  providers.NewAnthropicProvider(secret),
+		"azure":      providers.NewAzureOpenAIProvider("https://example.openai.azure.com", secret),
+		"bedrock":    bedrock,
+		"cohere":     providers.NewCohereProvider(secret),
+		"gemini":     providers.NewGeminiProvider(secret),
+		"groqcloud":  providers.NewGroqCloudProvider(secret),
+		"mistral":    providers.NewMistralProvider(secret),
+		"ollama":     ollama,
+		"openai":     providers.NewOpenAiProvider(secret),
+		"openrouter": providers.NewOpenRouterProvider(secret),
+		"perplexity": providers.NewPerplexityProvider(secret),
+		"xai":        providers.NewXaiProvider(secret),
+	}
+}
+
+func request() ([]sdk.Message, *sdk.Options) {
+	return []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"}
+}
+
+func TestErrorBodiesDoNotLeakKeys(t *testing.T) {
+	var urls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		urls = append(urls, req.URL.String())
+		w.WriteHeader(http.StatusUnauthorized)
+		// an upstream that echoes the credentials it rejected
+		fmt.Fprintf(w, `{"error":"bad credentials %v at %s"}`, req.Header, req.URL)
+	}))
+	defer server.Close()
+	useTransport(t, redirectTo(server))
+
+	for name, p := range keyedProviders() {
+		messages, opts := request()
+		_, err := p.CreateCompletion(context.Background(), messages, opts)
+
+		var apiErr *sdk.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %v, want an APIError", name, err)
+			continue
+		}
+		if strings.Contains(err.Error(), secret) || strings.Contains(string(apiErr.Body), secret) {
+			t.Errorf("%s: key leaked in %q", name, err)
+		}
+	}
+
+	for _, u := range urls {
+		if strings.Contains(u, "key=") || strings.Contains(u, secret) {
+			t.Errorf("request URL %s carries the key", u)
+		}
+	}
+}
+
+func TestTransportErrorsDoNotLeakKeys(t *testing.T) {
+	refused := errors.New("connection refused")
+	useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// a proxy that reports the request it failed to forward
+		return nil, fmt.Errorf("proxy rejected %s %v: %w", req.URL, req.Header, refused)
+	}))
+
+	for name, p := range keyedProviders() {
+		messages, opts := request()
+		_, err := p.CreateCompletion(context.Background(), messages, opts)
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+			continue
+		}
+		if strings.Contains(err.Error(), secret) {
+			t.Errorf("%s: key leaked in %q", name, err)
+		}
+		if !errors.Is(err, refused) {
+			t.Errorf("%s: err = %v, want it to wrap the transport error", name, err)
+		}
+	}
+}
+
+func TestStreamErrorsDoNotLeakKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, req.Header.Get("x-goog-api-key"))
+	}))
+	defer server.Close()
+	useTransport(t, redirectTo(server))
+
+	messages, opts := request()
+	_, err := providers.NewGeminiProvider(secret).CreateCompletionStream(context.Background(), messages, opts)
+	if err == nil || strings.Contains(err.Error(), secret) {
+		t.Errorf("err = %v, want an error without the key", err)
+	}
+}
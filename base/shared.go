@@ -13,7 +13,42 @@ import (
 
 // parses a streaming JSON response and calls onChunk for each content chunk
 func ParseJsonStream(body io.Reader, onChunk func(string) error) error {
+	return ParseJsonEvents(body, func(evt sdk.StreamEvent) error {
+		if evt.Content == "" {
+			return nil
+		}
+		return onChunk(evt.Content)
+	})
+}
+
+// a tool call assembled from indexed delta pieces
+type openAiToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// parses a streaming JSON response and calls onEvent for each content or reasoning chunk,
+// tool calls are collected from their pieces and sent once the choice finishes
+func ParseJsonEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
 	reader := bufio.NewReader(body)
+	var pending []*openAiToolCall
+	byIndex := map[int]*openAiToolCall{}
+
+	flush := func() error {
+		for _, tc := range pending {
+			call := tc.toSDK()
+			if err := onEvent(sdk.StreamEvent{ToolCall: &call}); err != nil {
+				return err
+			}
+		}
+		pending = nil
+		byIndex = map[int]*openAiToolCall{}
+		return nil
+	}
 
 	for {
 		line, err := reader.ReadBytes('\n')
@@ -26,21 +61,50 @@ func ParseJsonStream(body io.Reader, onChunk func(string) error) error {
 				line = line[len("data: "):]
 			}
 			if bytes.Equal(line, []byte("[DONE]")) {
-				return nil
+				return flush()
 			}
 
 			var chunk struct {
 				Choices []struct {
-					Delta struct {
-						Content string `json:"content"`
+					FinishReason string `json:"finish_reason"`
+					Delta        struct {
+						Content          string                `json:"content"`
+						ReasoningContent string                `json:"reasoning_content"`
+						Reasoning        string                `json:"reasoning"`
+						ToolCalls        []openAiToolCallDelta `json:"tool_calls"`
 					} `json:"delta"`
 				} `json:"choices"`
 			}
 
 			if err := json.Unmarshal(line, &chunk); err == nil {
 				for _, c := range chunk.Choices {
-					if c.Delta.Content != "" {
-						if err := onChunk(c.Delta.Content); err != nil {
+					evt := sdk.StreamEvent{
+						Content:   c.Delta.Content,
+						Reasoning: c.Delta.ReasoningContent + c.Delta.Reasoning,
+					}
+					if evt.Content != "" || evt.Reasoning != "" {
+						if err := onEvent(evt); err != nil {
+							return err
+						}
+					}
+					for _, d := range c.Delta.ToolCalls {
+						tc, ok := byIndex[d.Index]
+						if !ok {
+							tc = &openAiToolCall{}
+							byIndex[d.Index] = tc
+							pending = append(pending, tc)
+						}
+						if d.ID != "" {
+							tc.ID = d.ID
+						}
+						tc.Function.Name += d.Function.Name
+						tc.Function.Arguments += d.Function.Arguments
+					}
+					if c.FinishReason == "content_filter" {
+						return &sdk.ContentBlockedError{Reason: c.FinishReason, Body: line}
+					}
+					if c.FinishReason != "" {
+						if err := flush(); err != nil {
 							return err
 						}
 					}
@@ -50,7 +114,7 @@ func ParseJsonStream(body io.Reader, onChunk func(string) error) error {
 
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				return flush()
 			}
 			return err
 		}
@@ -70,16 +134,16 @@ func ExtractJsonResponse(body []byte) (*sdk.CompletionResponse, error) {
 
 	var parsed struct {
 		Choices []struct {
-			Message struct {
-				Role      string `json:"role"`
-				Content   string `json:"content,omitempty"`
-				ToolCalls []struct {
-					ID        string `json:"id"`
-					Name      string `json:"name"`
-					Arguments string `json:"arguments"`
-				} `json:"tool_calls,omitempty"`
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Role             string           `json:"role"`
+				Content          string           `json:"content,omitempty"`
+				ReasoningContent string           `json:"reasoning_content,omitempty"`
+				Reasoning        string           `json:"reasoning,omitempty"`
+				ToolCalls        []openAiToolCall `json:"tool_calls,omitempty"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage *sdk.Usage `json:"usage,omitempty"`
 	}
 
 	if err := json.Unmarshal(body, &parsed); err != nil {
@@ -87,7 +151,11 @@ func ExtractJsonResponse(body []byte) (*sdk.CompletionResponse, error) {
 	}
 
 	if len(parsed.Choices) == 0 {
-		return &sdk.CompletionResponse{}, nil
+		return &sdk.CompletionResponse{Usage: parsed.Usage}, nil
+	}
+
+	if parsed.Choices[0].FinishReason == "content_filter" {
+		return nil, &sdk.ContentBlockedError{Reason: "content_filter", Body: body}
 	}
 
 	msg := parsed.Choices[0].Message
@@ -95,16 +163,14 @@ func ExtractJsonResponse(body []byte) (*sdk.CompletionResponse, error) {
 	// Convert tool calls to SDK format
 	toolCalls := make([]sdk.ToolCallRequest, 0, len(msg.ToolCalls))
 	for _, tc := range msg.ToolCalls {
-		toolCalls = append(toolCalls, sdk.ToolCallRequest{
-			ID:        tc.ID,
-			Name:      tc.Name,
-			Arguments: json.RawMessage(tc.Arguments),
-		})
+		toolCalls = append(toolCalls, tc.toSDK())
 	}
 
 	return &sdk.CompletionResponse{
 		Content:   msg.Content,
 		ToolCalls: toolCalls,
 		Role:      msg.Role,
+		Usage:     parsed.Usage,
+		Reasoning: msg.ReasoningContent + msg.Reasoning,
 	}, nil
 }
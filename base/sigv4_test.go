@@ -0,0 +1,39 @@
+package base
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// vectors from the AWS Signature Version 4 test suite
+func TestSignV4Vectors(t *testing.T) {
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		method    string
+		signature string
+	}{
+		{"get-vanilla", "GET", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"post-vanilla", "POST", "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "https://example.amazonaws.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SignV4(req, creds, "us-east-1", "service", now); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: Authorization = %s\nwant %s", tt.name, got, want)
+		}
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%s: X-Amz-Date = %s", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// MCP client that exposes the tools of an MCP server as sdk tools
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type Client struct {
+	transport  Transport
+	nextID     atomic.Int64
+	ClientInfo Implementation
+	Server     *InitializeResult // set by Initialize
+}
+
+func NewClient(transport Transport) *Client {
+	return &Client{
+		transport:  transport,
+		ClientInfo: Implementation{Name: "unsafe0x0/ai", Version: "2"},
+	}
+}
+
+// starts an MCP server subprocess and initializes the session
+func NewStdioClient(ctx context.Context, command string, args ...string) (*Client, error) {
+	transport, err := NewStdioTransport(exec.Command(command, args...))
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(transport)
+	if err := c.Initialize(ctx); err != nil {
+		transport.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connects to an MCP server over streamable HTTP and initializes the session
+func NewHTTPClient(ctx context.Context, url string) (*Client, error) {
+	c := NewClient(NewHTTPTransport(url))
+	if err := c.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sends a request and decodes its result into out
+func (c *Client) call(ctx context.Context, method string, params any, out any) error {
+	req := &Request{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10)),
+		Method:  method,
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = b
+	}
+
+	resp, err := c.transport.Call(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// performs the initialize handshake
+func (c *Client) Initialize(ctx context.Context) error {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      c.ClientInfo,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	c.Server = &result
+
+	return c.transport.Notify(ctx, &Request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// lists every tool of the server, following pagination cursors
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	cursor := ""
+
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+
+		var result ListToolsResult
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// lists the server tools and converts them to sdk tools whose Execute calls tools/call
+func (c *Client) Tools(ctx context.Context) (map[string]sdk.Tool, error) {
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make(map[string]sdk.Tool, len(infos))
+	for _, info := range infos {
+		name := info.Name
+		// the server schema is sent as is, InputSchema is its closest sdk form
+		var raw json.RawMessage
+		if trimmed := bytes.TrimSpace(info.InputSchema); bytes.HasPrefix(trimmed, []byte("{")) {
+			raw = trimmed
+		}
+		tools[name] = sdk.Tool{
+			Description: info.Description,
+			InputSchema: ConvertSchema(info.InputSchema),
+			RawSchema:   raw,
+			Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+				result, err := c.CallTool(ctx, name, args)
+				if err != nil {
+					return nil, err
+				}
+				if result.IsError {
+					return nil, fmt.Errorf("%s", result.Text())
+				}
+				if len(result.StructuredContent) > 0 {
+					return result.StructuredContent, nil
+				}
+				return result.Text(), nil
+			},
+		}
+	}
+	return tools, nil
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+// converts a JSON schema object to an sdk input schema, nested objects included,
+// anyOf and oneOf take their first non null branch and local $refs are followed
+func ConvertSchema(schema json.RawMessage) sdk.InputSchema {
+	var root struct {
+		schemaProperty
+		Defs        map[string]schemaProperty `json:"$defs"`
+		Definitions map[string]schemaProperty `json:"definitions"`
+	}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return sdk.InputSchema{}
+	}
+
+	c := &schemaConverter{defs: map[string]schemaProperty{}, expanding: map[string]bool{}}
+	for name, def := range root.Definitions {
+		c.defs["#/definitions/"+name] = def
+	}
+	for name, def := range root.Defs {
+		c.defs["#/$defs/"+name] = def
+	}
+	return c.properties(root.schemaProperty)
+}
+
+type schemaProperty struct {
+	Type        json.RawMessage           `json:"type"`
+	Description string                    `json:"description"`
+	Enum        []any                     `json:"enum"`
+	Items       *schemaProperty           `json:"items"`
+	Properties  map[string]schemaProperty `json:"properties"`
+	Required    []string                  `json:"required"`
+	AnyOf       []schemaProperty          `json:"anyOf"`
+	OneOf       []schemaProperty          `json:"oneOf"`
+	Ref         string                    `json:"$ref"`
+}
+
+type schemaConverter struct {
+	defs      map[string]schemaProperty
+	expanding map[string]bool // refs being converted, meeting one again means the schema is recursive
+}
+
+func (c *schemaConverter) properties(p schemaProperty) sdk.InputSchema {
+	required := make(map[string]bool, len(p.Required))
+	for _, name := range p.Required {
+		required[name] = true
+	}
+
+	out := make(sdk.InputSchema, len(p.Properties))
+	for name, prop := range p.Properties {
+		converted := c.property(prop)
+		converted.Required = required[name]
+		out[name] = converted
+	}
+	return out
+}
+
+func (c *schemaConverter) property(p schemaProperty) sdk.Property {
+	if p.Ref != "" {
+		def, ok := c.defs[p.Ref]
+		if ok && !c.expanding[p.Ref] {
+			c.expanding[p.Ref] = true
+			defer delete(c.expanding, p.Ref)
+			return withDescription(c.property(def), p.Description)
+		}
+		// a recursive or external ref stops here
+		return sdk.Property{Type: "object", Description: p.Description}
+	}
+
+	if len(p.Type) == 0 {
+		for _, branch := range append(p.AnyOf, p.OneOf...) {
+			if schemaType(branch.Type) != "null" {
+				return withDescription(c.property(branch), p.Description)
+			}
+		}
+	}
+
+	out := sdk.Property{
+		Type:        schemaType(p.Type),
+		Description: p.Description,
+	}
+	if out.Type == "" {
+		switch {
+		case len(p.Properties) > 0:
+			out.Type = "object"
+		case p.Items != nil:
+			out.Type = "array"
+		default:
+			out.Type = "string"
+		}
+	}
+	for _, v := range p.Enum {
+		out.Enum = append(out.Enum, fmt.Sprint(v))
+	}
+	if p.Items != nil {
+		items := c.property(*p.Items)
+		out.Items = &items
+	}
+	if len(p.Properties) > 0 {
+		out.Properties = c.properties(p)
+	}
+	return out
+}
+
+// keeps the description of a ref or union over the one of its target
+func withDescription(p sdk.Property, description string) sdk.Property {
+	if description != "" {
+		p.Description = description
+	}
+	return p
+}
+
+// returns the JSON schema type, taking the first non null type of a type list, empty when not set
+func schemaType(raw json.RawMessage) string {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, t := range list {
+			if t != "null" {
+				return t
+			}
+		}
+	}
+	return ""
+}
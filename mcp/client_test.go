@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+const shipSchema = `{
+	"type": "object",
+	"properties": {
+		"address": {
+			"type": "object",
+			"description": "where to ship",
+			"properties": {"city": {"type": "string"}, "zip": {"type": "string"}},
+			"required": ["city"]
+		},
+		"mode": {"description": "transport", "anyOf": [{"type": "null"}, {"type": "string", "enum": ["air", "sea"]}]},
+		"items": {"type": "array", "items": {"$ref": "#/$defs/item"}},
+		"parent": {"$ref": "#/$defs/node"}
+	},
+	"required": ["address"],
+	"$defs": {
+		"item": {"type": "object", "properties": {"sku": {"type": "string"}, "qty": {"type": "integer"}}, "required": ["sku"]},
+		"node": {"type": "object", "properties": {"child": {"$ref": "#/$defs/node"}}}
+	}
+}`
+
+// the test binary doubles as a stdio MCP server when started with MCP_STUB_SERVER set
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_STUB_SERVER") != "" {
+		server := NewServer("stub", "1", map[string]sdk.Tool{
+			"ship": {
+				Description: "ships an order",
+				RawSchema:   json.RawMessage(shipSchema),
+				Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+					return "shipped " + string(args), nil
+				},
+			},
+		})
+		server.ServeStdio(context.Background(), os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStdioToolsKeepTheServerSchema(t *testing.T) {
+	t.Setenv("MCP_STUB_SERVER", "1")
+	ctx := context.Background()
+
+	client, err := NewStdioClient(ctx, os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tools, err := client.Tools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ship, ok := tools["ship"]
+	if !ok {
+		t.Fatalf("tools = %v, want ship", tools)
+	}
+
+	var want, got any
+	json.Unmarshal([]byte(shipSchema), &want)
+	json.Unmarshal(ship.RawSchema, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("raw schema = %s", ship.RawSchema)
+	}
+
+	// providers send the server schema rather than the converted one
+	parameters := base.OpenAiTools(tools)[0]["function"].(map[string]interface{})["parameters"]
+	if raw, ok := parameters.(json.RawMessage); !ok || !reflect.DeepEqual(raw, ship.RawSchema) {
+		t.Errorf("openai parameters = %v, want the raw schema", parameters)
+	}
+
+	out, err := ship.Execute(ctx, json.RawMessage(`{"address":{"city":"Oslo"}}`))
+	if err != nil || out != `shipped {"address":{"city":"Oslo"}}` {
+		t.Errorf("execute = %v, %v", out, err)
+	}
+}
+
+func TestConvertSchemaKeepsStructure(t *testing.T) {
+	schema := ConvertSchema(json.RawMessage(shipSchema))
+
+	address := schema["address"]
+	if !address.Required || address.Type != "object" || !address.Properties["city"].Required || address.Properties["zip"].Required {
+		t.Errorf("address = %+v", address)
+	}
+
+	mode := schema["mode"]
+	if mode.Type != "string" || mode.Description != "transport" || !reflect.DeepEqual(mode.Enum, []string{"air", "sea"}) {
+		t.Errorf("mode = %+v, want the non null anyOf branch", mode)
+	}
+
+	items := schema["items"]
+	if items.Type != "array" || items.Items == nil || !items.Items.Properties["sku"].Required || items.Items.Properties["qty"].Type != "integer" {
+		t.Errorf("items = %+v, want the resolved $ref", items)
+	}
+
+	child := schema["parent"].Properties["child"]
+	if child.Type != "object" || len(child.Properties) != 0 {
+		t.Errorf("recursive ref = %+v, want a plain object", child)
+	}
+}
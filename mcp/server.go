@@ -0,0 +1,340 @@
+// MCP server that serves sdk tools over stdio or streamable HTTP
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+// protocol versions the server can speak, the first one is preferred
+var supportedVersions = []string{ProtocolVersion, "2024-11-05"}
+
+type Server struct {
+	Info         Implementation
+	Instructions string        // optional usage hints sent to clients on initialize
+	SessionIdle  time.Duration // HTTP sessions unused for this long are forgotten, defaults to 1 hour
+
+	tools map[string]sdk.Tool
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // HTTP sessions started by initialize and when they were last used
+}
+
+func NewServer(name, version string, tools map[string]sdk.Tool) *Server {
+	return &Server{
+		Info:     Implementation{Name: name, Version: version},
+		tools:    tools,
+		sessions: make(map[string]time.Time),
+	}
+}
+
+// handles one request or notification, returns nil for notifications
+func (s *Server) handle(ctx context.Context, msg *message) *Response {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+
+	resp := &Response{JSONRPC: "2.0", ID: msg.ID}
+	result, err := s.dispatch(ctx, msg.Method, msg.Params)
+	if err != nil {
+		resp.Error = err
+		return resp
+	}
+
+	b, jsonErr := json.Marshal(result)
+	if jsonErr != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: jsonErr.Error()}
+		return resp
+	}
+	resp.Result = b
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (any, *RPCError) {
+	switch method {
+	case "initialize":
+		var p InitializeParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+			}
+		}
+		return s.initialize(&p), nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return ListToolsResult{Tools: s.listTools()}, nil
+	case "tools/call":
+		var p CallToolParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		tool, ok := s.tools[p.Name]
+		if !ok {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name}
+		}
+		return callTool(ctx, tool, p.Arguments), nil
+	default:
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+func (s *Server) initialize(p *InitializeParams) *InitializeResult {
+	// answer with the client's version when supported, otherwise with ours
+	version := supportedVersions[0]
+	for _, v := range supportedVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+
+	return &InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    map[string]any{"tools": map[string]any{}},
+		ServerInfo:      s.Info,
+		Instructions:    s.Instructions,
+	}
+}
+
+// describes the tools sorted by name
+func (s *Server) listTools() []ToolInfo {
+	names := make([]string, 0, len(s.tools))
+	for name := range s.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]ToolInfo, 0, len(names))
+	for _, name := range names {
+		tool := s.tools[name]
+		schema, _ := json.Marshal(tool.Schema())
+		infos = append(infos, ToolInfo{
+			Name:        name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+	return infos
+}
+
+// runs a tool, errors and panics are reported as error results so the model can see them
+func callTool(ctx context.Context, tool sdk.Tool, args json.RawMessage) (result *CallToolResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = errorResult(fmt.Sprintf("tool panicked: %v", r))
+		}
+	}()
+
+	if tool.Execute == nil {
+		return errorResult("tool has no Execute function")
+	}
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	out, err := tool.Execute(ctx, args)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+
+	// strings are sent as is, everything else as JSON
+	if text, ok := out.(string); ok {
+		return &CallToolResult{Content: []Content{{Type: "text", Text: text}}}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return errorResult(fmt.Sprintf("failed to marshal tool result: %s", err.Error()))
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: string(b)}}}
+}
+
+func errorResult(msg string) *CallToolResult {
+	return &CallToolResult{Content: []Content{{Type: "text", Text: msg}}, IsError: true}
+}
+
+// serves newline delimited JSON messages from in and writes responses to out until in is closed.
+// requests are handled concurrently so a slow tool does not block pings or other calls
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	var writeMu sync.Mutex
+	write := func(v any) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		out.Write(append(b, '\n'))
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var msg message
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+				write(&Response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: CodeParseError, Message: jsonErr.Error()}})
+			} else if !msg.isResponse() {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if resp := s.handle(ctx, &msg); resp != nil {
+						write(resp)
+					}
+				}()
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// serves the streamable HTTP transport, responses are always plain JSON.
+// server initiated streams are not supported so GET is rejected
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, r.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// a single message or a batch
+	var msgs []message
+	batch := len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '['
+	if batch {
+		err = json.Unmarshal(body, &msgs)
+	} else {
+		msgs = make([]message, 1)
+		err = json.Unmarshal(body, &msgs[0])
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &Response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+		return
+	}
+
+	initializing := false
+	for _, msg := range msgs {
+		if msg.Method == "initialize" {
+			initializing = true
+		}
+	}
+
+	sessionID := r.Header.Get("Mcp-Session-Id")
+	if initializing {
+		sessionID = s.startSession()
+		w.Header().Set("Mcp-Session-Id", sessionID)
+	} else if sessionID != "" && !s.useSession(sessionID) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	var responses []*Response
+	for i := range msgs {
+		if msgs[i].isResponse() {
+			continue
+		}
+		if resp := s.handle(r.Context(), &msgs[i]); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeJSON(w, http.StatusOK, responses)
+	default:
+		writeJSON(w, http.StatusOK, responses[0])
+	}
+}
+
+func (s *Server) sessionIdle() time.Duration {
+	if s.SessionIdle > 0 {
+		return s.SessionIdle
+	}
+	return time.Hour
+}
+
+// starts a new session and forgets the ones that have been idle too long,
+// clients that go away without a DELETE would otherwise stay in the map forever
+func (s *Server) startSession() string {
+	id := newSessionID()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for old, lastUsed := range s.sessions {
+		if now.Sub(lastUsed) > s.sessionIdle() {
+			delete(s.sessions, old)
+		}
+	}
+	s.sessions[id] = now
+	return id
+}
+
+// reports whether id is a live session and marks it as used
+func (s *Server) useSession(id string) bool {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastUsed, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+	if now.Sub(lastUsed) > s.sessionIdle() {
+		delete(s.sessions, id)
+		return false
+	}
+	s.sessions[id] = now
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func testServer() *Server {
+	return NewServer("test", "1", map[string]sdk.Tool{
+		"echo": {
+			Description: "echoes its arguments",
+			Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+				return "echo " + string(args), nil
+			},
+		},
+		"fail": {
+			Description: "always fails",
+			Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+				return nil, errors.New("disk full")
+			},
+		},
+	})
+}
+
+// posts body to the server, with session when it is not empty
+func post(t *testing.T, url, session, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("Mcp-Session-Id", session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func initialize(t *testing.T, url string) string {
+	t.Helper()
+	resp := post(t, url, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	var out struct {
+		Result InitializeResult `json:"result"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if out.Result.ProtocolVersion != "2024-11-05" || out.Result.ServerInfo.Name != "test" {
+		t.Errorf("initialize result = %+v", out.Result)
+	}
+
+	session := resp.Header.Get("Mcp-Session-Id")
+	if session == "" {
+		t.Fatal("initialize returned no session id")
+	}
+	return session
+}
+
+func TestHTTPSessions(t *testing.T) {
+	httpServer := httptest.NewServer(testServer())
+	defer httpServer.Close()
+	url := httpServer.URL
+
+	session := initialize(t, url)
+	if other := initialize(t, url); other == session {
+		t.Error("two initializes got the same session id")
+	}
+
+	if resp := post(t, url, session, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("ping in the session: status %d", resp.StatusCode)
+	}
+	if resp := post(t, url, session, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification: status %d, want 202", resp.StatusCode)
+	}
+	if resp := post(t, url, "made-up", `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want 404", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	req.Header.Set("Mcp-Session-Id", session)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: %v %v", resp, err)
+	}
+	if resp := post(t, url, session, `{"jsonrpc":"2.0","id":3,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted session: status %d, want 404", resp.StatusCode)
+	}
+
+	resp, _ := http.Get(url)
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestHTTPSessionsExpire(t *testing.T) {
+	server := testServer()
+	server.SessionIdle = 100 * time.Millisecond
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	idle := initialize(t, httpServer.URL)
+	active := initialize(t, httpServer.URL)
+	for i := 0; i < 4; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if resp := post(t, httpServer.URL, active, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); resp.StatusCode != http.StatusOK {
+			t.Fatalf("used session expired: status %d", resp.StatusCode)
+		}
+	}
+
+	if resp := post(t, httpServer.URL, idle, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("idle session: status %d, want 404", resp.StatusCode)
+	}
+
+	// sessions nobody asks about again are dropped when the next one starts
+	time.Sleep(110 * time.Millisecond)
+	initialize(t, httpServer.URL)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.sessions) != 1 {
+		t.Errorf("%d sessions kept, want only the new one", len(server.sessions))
+	}
+}
+
+func TestHTTPBatch(t *testing.T) {
+	httpServer := httptest.NewServer(testServer())
+	defer httpServer.Close()
+	session := initialize(t, httpServer.URL)
+
+	resp := post(t, httpServer.URL, session, `[
+		{"jsonrpc":"2.0","id":1,"method":"tools/list"},
+		{"jsonrpc":"2.0","method":"notifications/progress"},
+		{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"x":1}}},
+		{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fail"}},
+		{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"missing"}},
+		{"jsonrpc":"2.0","id":5,"method":"nope"}
+	]`)
+	var responses []Response
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 5 {
+		t.Fatalf("got %d responses, want one per request and none for the notification", len(responses))
+	}
+
+	var list ListToolsResult
+	json.Unmarshal(responses[0].Result, &list)
+	if len(list.Tools) != 2 || list.Tools[0].Name != "echo" || list.Tools[1].Name != "fail" {
+		t.Errorf("tools = %+v", list.Tools)
+	}
+
+	var echo, fail CallToolResult
+	json.Unmarshal(responses[1].Result, &echo)
+	json.Unmarshal(responses[2].Result, &fail)
+	if echo.IsError || echo.Text() != `echo {"x":1}` {
+		t.Errorf("echo result = %+v", echo)
+	}
+	if responses[2].Error != nil || !fail.IsError || fail.Text() != "disk full" {
+		t.Errorf("failing tool gave %+v %+v, want an isError result", responses[2].Error, fail)
+	}
+
+	if e := responses[3].Error; e == nil || e.Code != CodeInvalidParams {
+		t.Errorf("unknown tool error = %+v", e)
+	}
+	if e := responses[4].Error; e == nil || e.Code != CodeMethodNotFound || string(responses[4].ID) != "5" {
+		t.Errorf("unknown method error = %+v for id %s", e, responses[4].ID)
+	}
+}
+
+func TestHTTPParseError(t *testing.T) {
+	httpServer := httptest.NewServer(testServer())
+	defer httpServer.Close()
+
+	resp := post(t, httpServer.URL, "", `{not json`)
+	body, _ := io.ReadAll(resp.Body)
+	var out Response
+	json.Unmarshal(body, &out)
+	if resp.StatusCode != http.StatusBadRequest || out.Error == nil || out.Error.Code != CodeParseError {
+		t.Errorf("status %d body %s, want a parse error", resp.StatusCode, body)
+	}
+}
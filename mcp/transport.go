@@ -0,0 +1,333 @@
+// stdio and streamable HTTP transports for MCP clients
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Transport interface {
+	// sends a request and waits for its response
+	Call(ctx context.Context, req *Request) (*Response, error)
+	// sends a notification, no response is expected
+	Notify(ctx context.Context, req *Request) error
+	Close() error
+}
+
+// talks to an MCP server running as a subprocess using newline delimited JSON on stdin and stdout
+type StdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *Response
+	done    chan struct{}
+	err     error
+}
+
+// starts cmd and returns a transport connected to its stdin and stdout
+func NewStdioTransport(cmd *exec.Cmd) (*StdioTransport, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &StdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan *Response),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *StdioTransport) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	var readErr error
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var msg message
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr == nil {
+				t.handle(&msg)
+			}
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	if errors.Is(readErr, io.EOF) {
+		readErr = fmt.Errorf("mcp server closed the connection")
+	}
+
+	t.mu.Lock()
+	t.err = readErr
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *StdioTransport) handle(msg *message) {
+	if msg.isResponse() {
+		t.mu.Lock()
+		ch, ok := t.pending[string(msg.ID)]
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+		if ok {
+			ch <- &Response{JSONRPC: msg.JSONRPC, ID: msg.ID, Result: msg.Result, Error: msg.Error}
+		}
+		return
+	}
+
+	// requests from the server, only ping is supported
+	if len(msg.ID) > 0 {
+		resp := &Response{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			resp.Result = json.RawMessage("{}")
+		} else {
+			resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+		t.write(resp)
+	}
+}
+
+func (t *StdioTransport) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+func (t *StdioTransport) Call(ctx context.Context, req *Request) (*Response, error) {
+	ch := make(chan *Response, 1)
+
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[string(req.ID)] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.mu.Lock()
+		delete(t.pending, string(req.ID))
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			return nil, t.err
+		}
+		return resp, nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, string(req.ID))
+		t.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *StdioTransport) Notify(ctx context.Context, req *Request) error {
+	return t.write(req)
+}
+
+// closes stdin and waits for the server to exit, killing it if it does not exit in time
+func (t *StdioTransport) Close() error {
+	t.stdin.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- t.cmd.Wait() }()
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(5 * time.Second):
+		t.cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("mcp server did not exit, killed")
+	}
+}
+
+// talks to an MCP server over the streamable HTTP transport
+type HTTPTransport struct {
+	URL    string
+	Header http.Header  // extra headers, e.g. Authorization
+	Client *http.Client // defaults to http.DefaultClient
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func NewHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{URL: url, Header: http.Header{}}
+}
+
+func (t *HTTPTransport) post(ctx context.Context, req *Request) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", t.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.Header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	httpReq.Header.Set("MCP-Protocol-Version", ProtocolVersion)
+
+	t.mu.Lock()
+	if t.sessionID != "" {
+		httpReq.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("mcp http error %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+func (t *HTTPTransport) Call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readSSEResponse(resp.Body, req.ID)
+	}
+
+	var out Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode mcp response: %w", err)
+	}
+	return &out, nil
+}
+
+// reads server sent events until the response to id arrives
+func readSSEResponse(body io.Reader, id json.RawMessage) (*Response, error) {
+	reader := bufio.NewReader(body)
+	var data bytes.Buffer
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		trimmed := bytes.TrimRight(line, "\r\n")
+
+		if bytes.HasPrefix(trimmed, []byte("data:")) {
+			data.Write(bytes.TrimPrefix(bytes.TrimPrefix(trimmed, []byte("data:")), []byte(" ")))
+		}
+
+		// a blank line or the end of the body completes an event
+		if (len(trimmed) == 0 || err != nil) && data.Len() > 0 {
+			var msg message
+			if jsonErr := json.Unmarshal(data.Bytes(), &msg); jsonErr == nil && msg.isResponse() && bytes.Equal(msg.ID, id) {
+				return &Response{JSONRPC: msg.JSONRPC, ID: msg.ID, Result: msg.Result, Error: msg.Error}, nil
+			}
+			data.Reset()
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("mcp event stream ended without a response")
+		}
+	}
+}
+
+func (t *HTTPTransport) Notify(ctx context.Context, req *Request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ends the session on the server when one was started
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.sessionID = ""
+	t.mu.Unlock()
+
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest("DELETE", t.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -7,8 +7,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/unsafe0x0/ai/v2/base"
 	"github.com/unsafe0x0/ai/v2/sdk"
@@ -16,17 +19,96 @@ import (
 
 type AnthropicProvider struct {
 	*base.Provider
-	APIKey string
+	APIKey  string
+	Version string   // anthropic-version header, defaults to 2023-06-01
+	Betas   []string // anthropic-beta features sent with every request
 }
 
 func NewAnthropicProvider(apiKey string) *AnthropicProvider {
 	p := &AnthropicProvider{
-		APIKey: apiKey,
+		APIKey:  apiKey,
+		Version: anthropicVersion,
 	}
-	p.Provider = &base.Provider{APICaller: p}
+	p.Provider = &base.Provider{APICaller: p, Name: "anthropic"}
 	return p
 }
 
+type AnthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type AnthropicContentBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"`
+	ToolUseID    string                 `json:"tool_use_id,omitempty"`
+	Content      string                 `json:"content,omitempty"`
+	Thinking     string                 `json:"thinking,omitempty"`
+	Signature    string                 `json:"signature,omitempty"`
+	Data         string                 `json:"data,omitempty"`
+	CacheControl *AnthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+type AnthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  any                    `json:"input_schema"`
+	CacheControl *AnthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type AnthropicResponse struct {
+	Role       string                  `json:"role"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+const (
+	anthropicVersion           = "2023-06-01"
+	anthropicPromptCachingBeta = "prompt-caching-2024-07-31"
+)
+
+// max output tokens by model name prefix, used as max_tokens when a request sets none,
+// the longest matching prefix wins and unknown models get 4096
+var AnthropicMaxOutputTokens = map[string]int{
+	"claude-3-haiku":    4096,
+	"claude-3-opus":     4096,
+	"claude-3-sonnet":   4096,
+	"claude-3-5-haiku":  8192,
+	"claude-3-5-sonnet": 8192,
+	"claude-3-7-sonnet": 64000,
+	"claude-sonnet-4":   64000,
+	"claude-haiku-4":    64000,
+	"claude-opus-4":     32000,
+	"claude-opus-4-5":   64000,
+}
+
+func anthropicDefaultMaxTokens(model string) int {
+	maxTokens, matched := 4096, ""
+	for prefix, tokens := range AnthropicMaxOutputTokens {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			maxTokens, matched = tokens, prefix
+		}
+	}
+	return maxTokens
+}
+
+var ephemeralCache = &AnthropicCacheControl{Type: "ephemeral"}
+
 func (p *AnthropicProvider) CallAPI(
 	ctx context.Context,
 	messages []sdk.Message,
@@ -35,26 +117,24 @@ func (p *AnthropicProvider) CallAPI(
 ) (io.ReadCloser, error) {
 	url := "https://api.anthropic.com/v1/messages"
 
-	chatMessages := []map[string]string{}
-	for _, m := range messages {
-		chatMessages = append(chatMessages, map[string]string{
-			"role":    m.Role,
-			"content": m.Content,
-		})
-	}
+	system, usesCache := anthropicSystemBlocks(messages, opts)
+	chatMessages, messagesCached := convertAnthropicMessages(messages)
+	usesCache = usesCache || messagesCached
 
-	var systemPrompt string
-	if len(chatMessages) > 0 && chatMessages[0]["role"] == "system" {
-		systemPrompt = chatMessages[0]["content"]
-		chatMessages = chatMessages[1:]
+	var model string
+	if opts != nil {
+		model = opts.Model
 	}
 
 	body := map[string]interface{}{
-		"system":     systemPrompt,
 		"messages":   chatMessages,
 		"stream":     streamMode,
-		"max_tokens": 1024,
+		"max_tokens": anthropicDefaultMaxTokens(model),
 	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+
 	if opts != nil {
 		if opts.Model != "" {
 			body["model"] = opts.Model
@@ -62,12 +142,44 @@ func (p *AnthropicProvider) CallAPI(
 		if opts.MaxCompletionTokens != 0 {
 			body["max_tokens"] = opts.MaxCompletionTokens
 		}
-		if opts.ReasoningEffort != "" {
-			body["reasoning_effort"] = opts.ReasoningEffort
-		}
 		if opts.Temperature != 0 {
 			body["temperature"] = opts.Temperature
 		}
+		if opts.TopP != 0 {
+			body["top_p"] = opts.TopP
+		}
+		if opts.TopK != 0 {
+			body["top_k"] = opts.TopK
+		}
+		if len(opts.StopSequences) > 0 {
+			body["stop_sequences"] = opts.StopSequences
+		}
+		if opts.User != "" {
+			body["metadata"] = map[string]interface{}{"user_id": opts.User}
+		}
+		if r := opts.ReasoningConfig(); r != nil {
+			// anthropic requires a budget of at least 1024 tokens that fits inside max_tokens
+			budget := max(r.Budget(), 1024)
+			body["thinking"] = map[string]interface{}{
+				"type":          "enabled",
+				"budget_tokens": budget,
+			}
+			if maxTokens := body["max_tokens"].(int); maxTokens <= budget {
+				body["max_tokens"] = budget + maxTokens
+			}
+			// temperature and top_k cannot be changed while thinking is enabled
+			delete(body, "temperature")
+			delete(body, "top_k")
+		}
+		if len(opts.Tools) > 0 {
+			tools, toolsCached := convertAnthropicTools(opts.Tools)
+			body["tools"] = tools
+			usesCache = usesCache || toolsCached
+
+			if choice := anthropicToolChoice(opts); choice != nil {
+				body["tool_choice"] = choice
+			}
+		}
 	}
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
@@ -78,55 +190,147 @@ func (p *AnthropicProvider) CallAPI(
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("x-api-key", p.APIKey)
+	version := p.Version
+	if version == "" {
+		version = anthropicVersion
+	}
+	betas := p.Betas
+	if usesCache {
+		betas = append(betas[:len(betas):len(betas)], anthropicPromptCachingBeta)
+	}
+
+	req.Header.Set("x-api-key", p.ResolveAPIKey(ctx, p.APIKey))
+	req.Header.Set("anthropic-version", version)
 	req.Header.Set("Content-Type", "application/json")
+	if len(betas) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(betas, ","))
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, &sdk.APIError{
-			StatusCode: resp.StatusCode,
-			Message:    string(b),
-			Body:       b,
-		}
-	}
 	return resp.Body, nil
 }
 
+// streams only the content text, kept for callers of the StreamParser interface
 func (p *AnthropicProvider) ParseResponse(body io.Reader, onChunk func(string) error) error {
+	return base.ParseContent(p, body, onChunk)
+}
+
+// runs the messages stream state machine, content blocks are tracked by index until they stop
+func (p *AnthropicProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
 	reader := bufio.NewReader(body)
+	thinking := map[int]*sdk.ThinkingBlock{}
+	toolUses := map[int]*AnthropicContentBlock{}
+	toolInput := map[int]*strings.Builder{}
+	outputTokens := 0
 
 	for {
 		line, err := reader.ReadBytes('\n')
-		if len(line) > 0 {
-			line = bytes.TrimSpace(line)
-			if len(line) == 0 {
-				continue
-			}
-			if bytes.HasPrefix(line, []byte("data: ")) {
-				line = line[len("data: "):]
-			}
-			if bytes.Equal(line, []byte("[DONE]")) {
-				return nil
-			}
+		if line = bytes.TrimSpace(line); bytes.HasPrefix(line, []byte("data:")) {
+			line = bytes.TrimSpace(line[len("data:"):])
+
 			var evt struct {
-				Type  string `json:"type"`
+				Type         string                `json:"type"`
+				Index        int                   `json:"index"`
+				ContentBlock AnthropicContentBlock `json:"content_block"`
+				Message      struct {
+					Usage *AnthropicUsage `json:"usage"`
+				} `json:"message"`
 				Delta struct {
-					Text string `json:"text"`
+					Type        string `json:"type"`
+					Text        string `json:"text"`
+					Thinking    string `json:"thinking"`
+					Signature   string `json:"signature"`
+					PartialJSON string `json:"partial_json"`
 				} `json:"delta"`
+				Usage *AnthropicUsage `json:"usage"`
+				Error *struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if jsonErr := json.Unmarshal(line, &evt); jsonErr != nil {
+				return fmt.Errorf("failed to parse anthropic stream event: %w", jsonErr)
 			}
 
-			if err := json.Unmarshal(line, &evt); err == nil {
-				if evt.Type == "content_block_delta" && evt.Delta.Text != "" {
-					if err := onChunk(evt.Delta.Text); err != nil {
-						return err
+			var out sdk.StreamEvent
+
+			switch evt.Type {
+			case "message_start":
+				// input and cache tokens are known up front, output tokens follow in message_delta
+				if u := evt.Message.Usage; u != nil {
+					out.Usage = u.toSDK()
+					outputTokens = u.OutputTokens
+				}
+			case "content_block_start":
+				switch evt.ContentBlock.Type {
+				case "thinking":
+					thinking[evt.Index] = &sdk.ThinkingBlock{}
+				case "redacted_thinking":
+					thinking[evt.Index] = &sdk.ThinkingBlock{Redacted: evt.ContentBlock.Data}
+				case "tool_use":
+					block := evt.ContentBlock
+					toolUses[evt.Index] = &block
+					toolInput[evt.Index] = &strings.Builder{}
+				case "text":
+					out.Content = evt.ContentBlock.Text
+				}
+			case "content_block_delta":
+				switch evt.Delta.Type {
+				case "text_delta":
+					out.Content = evt.Delta.Text
+				case "thinking_delta":
+					if block, ok := thinking[evt.Index]; ok {
+						block.Text += evt.Delta.Thinking
+					}
+					out.Reasoning = evt.Delta.Thinking
+				case "signature_delta":
+					if block, ok := thinking[evt.Index]; ok {
+						block.Signature += evt.Delta.Signature
 					}
+				case "input_json_delta":
+					if b, ok := toolInput[evt.Index]; ok {
+						b.WriteString(evt.Delta.PartialJSON)
+					}
+				}
+			case "content_block_stop":
+				if block, ok := thinking[evt.Index]; ok {
+					out.Thinking = block
+					delete(thinking, evt.Index)
+				}
+				if tu, ok := toolUses[evt.Index]; ok {
+					input := json.RawMessage(toolInput[evt.Index].String())
+					if len(input) == 0 {
+						input = json.RawMessage("{}")
+					}
+					out.ToolCall = &sdk.ToolCallRequest{ID: tu.ID, Name: tu.Name, Arguments: input}
+					delete(toolUses, evt.Index)
+					delete(toolInput, evt.Index)
+				}
+			case "message_delta":
+				// output_tokens is cumulative, only the tokens not reported yet are emitted
+				if u := evt.Usage; u != nil && u.OutputTokens > outputTokens {
+					out.Usage = &sdk.Usage{
+						CompletionTokens: u.OutputTokens - outputTokens,
+						TotalTokens:      u.OutputTokens - outputTokens,
+					}
+					outputTokens = u.OutputTokens
+				}
+			case "message_stop":
+				return nil
+			case "error":
+				if evt.Error == nil {
+					return &sdk.APIError{StatusCode: http.StatusInternalServerError, Message: string(line), Body: line}
+				}
+				return anthropicStreamError(evt.Error.Type, evt.Error.Message, line)
+			}
+
+			if out.Content != "" || out.Reasoning != "" || out.Thinking != nil || out.ToolCall != nil || out.Usage != nil {
+				if evtErr := onEvent(out); evtErr != nil {
+					return evtErr
 				}
-				continue
 			}
 		}
 
@@ -138,3 +342,208 @@ func (p *AnthropicProvider) ParseResponse(body io.Reader, onChunk func(string) e
 		}
 	}
 }
+
+// turns an error event sent mid-stream into the APIError the same failure returns before streaming
+func anthropicStreamError(errType, message string, body []byte) error {
+	status := http.StatusInternalServerError
+	switch errType {
+	case "overloaded_error":
+		status = 529
+	case "rate_limit_error":
+		status = http.StatusTooManyRequests
+	case "invalid_request_error":
+		status = http.StatusBadRequest
+	case "authentication_error":
+		status = http.StatusUnauthorized
+	case "permission_error":
+		status = http.StatusForbidden
+	case "not_found_error":
+		status = http.StatusNotFound
+	case "request_too_large":
+		status = http.StatusRequestEntityTooLarge
+	}
+	if message == "" {
+		message = errType
+	}
+	return &sdk.APIError{StatusCode: status, Message: message, Body: body}
+}
+
+func (p *AnthropicProvider) ParseCompletion(body []byte) (*sdk.CompletionResponse, error) {
+	var resp AnthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse anthropic response: %w", err)
+	}
+
+	compResp := &sdk.CompletionResponse{Role: resp.Role, Usage: resp.Usage.toSDK()}
+
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			compResp.Content += block.Text
+		case "tool_use":
+			compResp.ToolCalls = append(compResp.ToolCalls, sdk.ToolCallRequest{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: block.Input,
+			})
+		case "thinking":
+			compResp.Reasoning += block.Thinking
+			compResp.Thinking = append(compResp.Thinking, sdk.ThinkingBlock{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			compResp.Thinking = append(compResp.Thinking, sdk.ThinkingBlock{Redacted: block.Data})
+		}
+	}
+
+	return compResp, nil
+}
+
+func (u *AnthropicUsage) toSDK() *sdk.Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return &sdk.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
+
+// merges every system message into system blocks in order, reports whether any cache breakpoint was set
+func anthropicSystemBlocks(messages []sdk.Message, opts *sdk.Options) ([]AnthropicContentBlock, bool) {
+	var blocks []AnthropicContentBlock
+	usesCache := false
+
+	for _, m := range messages {
+		if m.Role != "system" || m.Content == "" {
+			continue
+		}
+		block := AnthropicContentBlock{Type: "text", Text: m.Content}
+		if m.CacheControl {
+			block.CacheControl = ephemeralCache
+			usesCache = true
+		}
+		blocks = append(blocks, block)
+	}
+
+	if len(blocks) > 0 && opts != nil && opts.CacheSystemPrompt {
+		blocks[len(blocks)-1].CacheControl = ephemeralCache
+		usesCache = true
+	}
+	return blocks, usesCache
+}
+
+// converts sdk messages to anthropic messages, reports whether any cache breakpoint was set,
+// system messages are skipped as they go in the system blocks
+func convertAnthropicMessages(messages []sdk.Message) ([]AnthropicMessage, bool) {
+	var out []AnthropicMessage
+	usesCache := false
+
+	for _, m := range messages {
+		role := m.Role
+		if role == "system" {
+			continue
+		}
+		var blocks []AnthropicContentBlock
+
+		if role == "tool" {
+			role = "user"
+			blocks = append(blocks, AnthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   m.Content,
+			})
+		} else {
+			// signed thinking blocks must be sent back unchanged before the tool use they led to
+			for _, t := range m.Thinking {
+				if t.Redacted != "" {
+					blocks = append(blocks, AnthropicContentBlock{Type: "redacted_thinking", Data: t.Redacted})
+				} else if t.Signature != "" {
+					blocks = append(blocks, AnthropicContentBlock{Type: "thinking", Thinking: t.Text, Signature: t.Signature})
+				}
+			}
+			if m.Content != "" {
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := tc.Arguments
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, AnthropicContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Name,
+					Input: input,
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if m.CacheControl {
+			blocks[len(blocks)-1].CacheControl = ephemeralCache
+			usesCache = true
+		}
+
+		// tool results for one assistant turn must share a single user message
+		if len(out) > 0 && out[len(out)-1].Role == role {
+			out[len(out)-1].Content = append(out[len(out)-1].Content, blocks...)
+			continue
+		}
+		out = append(out, AnthropicMessage{Role: role, Content: blocks})
+	}
+
+	return out, usesCache
+}
+
+// converts sdk tools to anthropic tools sorted by name so the prompt cache prefix is stable
+func convertAnthropicTools(sdkTools map[string]sdk.Tool) ([]AnthropicTool, bool) {
+	names := make([]string, 0, len(sdkTools))
+	for name := range sdkTools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]AnthropicTool, 0, len(names))
+	usesCache := false
+	for _, name := range names {
+		tool := sdkTools[name]
+		t := AnthropicTool{
+			Name:        name,
+			Description: tool.Description,
+			InputSchema: tool.Schema(),
+		}
+		if tool.CacheControl {
+			t.CacheControl = ephemeralCache
+			usesCache = true
+		}
+		tools = append(tools, t)
+	}
+	return tools, usesCache
+}
+
+// maps the tool choice and parallel tool calls options to an anthropic tool_choice
+func anthropicToolChoice(opts *sdk.Options) map[string]interface{} {
+	if opts.ToolChoice == "" && opts.ParallelToolCalls == nil {
+		return nil
+	}
+
+	choice := map[string]interface{}{"type": "auto"}
+	switch opts.ToolChoice {
+	case "", sdk.ToolChoiceAuto:
+	case sdk.ToolChoiceNone:
+		choice["type"] = "none"
+	case sdk.ToolChoiceRequired:
+		choice["type"] = "any"
+	default:
+		choice["type"] = "tool"
+		choice["name"] = opts.ToolChoice
+	}
+
+	if opts.ParallelToolCalls != nil && !*opts.ParallelToolCalls && choice["type"] != "none" {
+		choice["disable_parallel_tool_use"] = true
+	}
+	return choice
+}
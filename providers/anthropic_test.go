@@ -0,0 +1,439 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func TestAnthropicStreamToolUseAndUsage(t *testing.T) {
+	stream := `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: ping
+data: {"type":"ping"}
+
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}
+data: {"type":"content_block_stop","index":0}
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu1","name":"weather","input":{}}}
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Oslo\"}"}}
+data: {"type":"content_block_stop","index":1}
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}
+data: {"type":"message_stop"}
+`
+	var content string
+	var calls []sdk.ToolCallRequest
+	usage := &sdk.Usage{}
+	err := NewAnthropicProvider("key").ParseEvents(strings.NewReader(stream), func(evt sdk.StreamEvent) error {
+		content += evt.Content
+		if evt.ToolCall != nil {
+			calls = append(calls, *evt.ToolCall)
+		}
+		usage.Add(evt.Usage)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hi" {
+		t.Errorf("content = %q", content)
+	}
+	if len(calls) != 1 || calls[0].ID != "tu1" || string(calls[0].Arguments) != `{"city":"Oslo"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if usage.PromptTokens != 10 || usage.CompletionTokens != 20 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicStreamErrors(t *testing.T) {
+	for name, stream := range map[string]string{
+		"overloaded": `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		"no object":  `data: {"type":"error"}`,
+	} {
+		err := NewAnthropicProvider("key").ParseEvents(strings.NewReader(stream+"\n"), func(sdk.StreamEvent) error { return nil })
+		var apiErr *sdk.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: got %v, want an APIError", name, err)
+			continue
+		}
+		if name == "overloaded" && apiErr.StatusCode != 529 {
+			t.Errorf("%s: status = %d", name, apiErr.StatusCode)
+		}
+	}
+}
+
+const anthropicReply = `{"role":"assistant","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`
+
+// sends one request through p and returns the decoded body and the headers it was sent with
+func anthropicRequest(t *testing.T, p *AnthropicProvider, messages []sdk.Message, opts *sdk.Options) (map[string]any, http.Header) {
+	t.Helper()
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, anthropicReply))
+	if _, err := p.CreateCompletion(context.Background(), messages, opts); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body, rec.headers[0]
+}
+
+func TestAnthropicRequestBody(t *testing.T) {
+	p := NewAnthropicProvider("key")
+	p.Version = "2024-01-01"
+	p.Betas = []string{"token-efficient-tools-2025-02-19", "output-128k-2025-02-19"}
+
+	body, headers := anthropicRequest(t, p, []sdk.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "hi"},
+		{Role: "system", Content: ""},
+		{Role: "system", Content: "Answer in English."},
+	}, &sdk.Options{
+		Model:         "claude-3-5-haiku-20241022",
+		TopP:          0.5,
+		TopK:          40,
+		StopSequences: []string{"END"},
+		User:          "user-1",
+	})
+
+	var system []AnthropicContentBlock
+	b, _ := json.Marshal(body["system"])
+	json.Unmarshal(b, &system)
+	if len(system) != 2 || system[0].Text != "Be brief." || system[1].Text != "Answer in English." {
+		t.Errorf("system = %+v, want every non-empty system message in order", system)
+	}
+	if messages := body["messages"].([]any); len(messages) != 1 {
+		t.Errorf("messages = %v, want only the user message", messages)
+	}
+
+	if body["max_tokens"] != float64(8192) || body["top_p"] != 0.5 || body["top_k"] != float64(40) {
+		t.Errorf("max_tokens %v top_p %v top_k %v", body["max_tokens"], body["top_p"], body["top_k"])
+	}
+	if stop := body["stop_sequences"].([]any); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("stop_sequences = %v", stop)
+	}
+	if metadata, _ := body["metadata"].(map[string]any); metadata["user_id"] != "user-1" {
+		t.Errorf("metadata = %v", body["metadata"])
+	}
+	for _, unset := range []string{"temperature", "tools", "tool_choice", "thinking"} {
+		if _, ok := body[unset]; ok {
+			t.Errorf("%s is set without being asked for", unset)
+		}
+	}
+
+	if headers.Get("anthropic-version") != "2024-01-01" || headers.Get("x-api-key") != "key" {
+		t.Errorf("headers = %v", headers)
+	}
+	if headers.Get("anthropic-beta") != "token-efficient-tools-2025-02-19,output-128k-2025-02-19" {
+		t.Errorf("anthropic-beta = %q", headers.Get("anthropic-beta"))
+	}
+}
+
+func TestAnthropicDefaults(t *testing.T) {
+	p := NewAnthropicProvider("key")
+	p.Version = ""
+
+	for model, want := range map[string]float64{
+		"claude-opus-4-20250514":   32000,
+		"claude-opus-4-5-20251101": 64000, // the longest prefix wins
+		"claude-3-haiku-20240307":  4096,
+		"some-new-model":           4096,
+	} {
+		body, headers := anthropicRequest(t, p, []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: model})
+		if body["max_tokens"] != want {
+			t.Errorf("%s: max_tokens = %v, want %v", model, body["max_tokens"], want)
+		}
+		if headers.Get("anthropic-version") != "2023-06-01" || headers.Get("anthropic-beta") != "" {
+			t.Errorf("%s: version %q beta %q", model, headers.Get("anthropic-version"), headers.Get("anthropic-beta"))
+		}
+	}
+
+	body, _ := anthropicRequest(t, p, []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "claude-opus-4-20250514", MaxCompletionTokens: 100})
+	if body["max_tokens"] != float64(100) {
+		t.Errorf("max_tokens = %v, want the requested 100", body["max_tokens"])
+	}
+}
+
+func TestAnthropicToolChoice(t *testing.T) {
+	no := false
+	for _, tc := range []struct {
+		choice   string
+		parallel *bool
+		want     string
+	}{
+		{"", nil, "null"},
+		{"", &no, `{"disable_parallel_tool_use":true,"type":"auto"}`},
+		{"required", nil, `{"type":"any"}`},
+		{"none", &no, `{"type":"none"}`},
+		{"weather", &no, `{"disable_parallel_tool_use":true,"name":"weather","type":"tool"}`},
+	} {
+		body := toolChoiceBody(t, NewAnthropicProvider("key"), anthropicReply, tc.choice, tc.parallel)
+		if got := jsonOf(body["tool_choice"]); got != tc.want {
+			t.Errorf("%q parallel %v: tool_choice = %s, want %s", tc.choice, tc.parallel, got, tc.want)
+		}
+	}
+}
+
+// the cache_control marks in a request, by where they are
+func cacheMarks(t *testing.T, body map[string]any) []string {
+	t.Helper()
+	var req struct {
+		System   []AnthropicContentBlock `json:"system"`
+		Tools    []AnthropicTool         `json:"tools"`
+		Messages []AnthropicMessage      `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(jsonOf(body)), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	var marks []string
+	mark := func(where string, c *AnthropicCacheControl) {
+		if c != nil {
+			marks = append(marks, where+":"+c.Type)
+		}
+	}
+	for i, b := range req.System {
+		mark(fmt.Sprintf("system[%d]", i), b.CacheControl)
+	}
+	for _, tool := range req.Tools {
+		mark("tool "+tool.Name, tool.CacheControl)
+	}
+	for i, m := range req.Messages {
+		for j, b := range m.Content {
+			mark(fmt.Sprintf("messages[%d] %s[%d]", i, b.Type, j), b.CacheControl)
+		}
+	}
+	return marks
+}
+
+func TestAnthropicCacheControl(t *testing.T) {
+	p := NewAnthropicProvider("key")
+	p.Betas = []string{"output-128k-2025-02-19"}
+
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, `{"role":"assistant","content":[{"type":"text","text":"ok"}],
+		"usage":{"input_tokens":5,"output_tokens":2,"cache_creation_input_tokens":100,"cache_read_input_tokens":900}}`))
+
+	messages := []sdk.Message{
+		{Role: "system", Content: "rules", CacheControl: true},
+		{Role: "system", Content: "more rules"},
+		{Role: "user", Content: "weather?"},
+		{Role: "assistant", Content: "checking", ToolCalls: []sdk.ToolCallRequest{{ID: "t1", Name: "weather"}, {ID: "t2", Name: "time"}}, CacheControl: true},
+		{Role: "tool", ToolCallID: "t1", Content: "sunny", CacheControl: true},
+		{Role: "tool", ToolCallID: "t2", Content: "noon"},
+	}
+	resp, err := p.CreateCompletion(context.Background(), messages, &sdk.Options{
+		Model:             "claude-sonnet-4-20250514",
+		CacheSystemPrompt: true,
+		Tools: map[string]sdk.Tool{
+			"weather": {Description: "weather", CacheControl: true},
+			"time":    {Description: "time"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]any
+	json.Unmarshal([]byte(rec.bodies[0]), &body)
+	want := []string{
+		"system[0]:ephemeral",
+		"system[1]:ephemeral", // CacheSystemPrompt marks the end of the system prompt
+		"tool weather:ephemeral",
+		"messages[1] tool_use[2]:ephemeral", // after the last block of the message
+		"messages[2] tool_result[0]:ephemeral",
+	}
+	if got := cacheMarks(t, body); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("cache marks:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if beta := rec.headers[0].Get("anthropic-beta"); beta != "output-128k-2025-02-19,prompt-caching-2024-07-31" {
+		t.Errorf("anthropic-beta = %q", beta)
+	}
+	if len(p.Betas) != 1 {
+		t.Errorf("Betas = %v, the caching beta was added to the provider", p.Betas)
+	}
+
+	u := resp.Usage
+	if u.CacheReadTokens != 900 || u.CacheWriteTokens != 100 || u.PromptTokens != 1005 || u.TotalTokens != 1007 {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestAnthropicWithoutCacheControl(t *testing.T) {
+	body, headers := anthropicRequest(t, NewAnthropicProvider("key"), []sdk.Message{
+		{Role: "system", Content: "rules"},
+		{Role: "user", Content: "hi"},
+	}, &sdk.Options{Model: "m", Tools: map[string]sdk.Tool{"weather": {Description: "weather"}}})
+
+	if marks := cacheMarks(t, body); len(marks) != 0 {
+		t.Errorf("cache marks = %v", marks)
+	}
+	if beta := headers.Get("anthropic-beta"); beta != "" {
+		t.Errorf("anthropic-beta = %q without any cache breakpoint", beta)
+	}
+}
+
+func TestAnthropicStreamCacheUsage(t *testing.T) {
+	stream := `data: {"type":"message_start","message":{"usage":{"input_tokens":5,"output_tokens":1,"cache_creation_input_tokens":100,"cache_read_input_tokens":900}}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ok"}}
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}
+data: {"type":"message_stop"}
+`
+	usage := &sdk.Usage{}
+	err := NewAnthropicProvider("key").ParseEvents(strings.NewReader(stream), func(evt sdk.StreamEvent) error {
+		usage.Add(evt.Usage)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.CacheReadTokens != 900 || usage.CacheWriteTokens != 100 || usage.PromptTokens != 1005 || usage.CompletionTokens != 3 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicThinkingRequest(t *testing.T) {
+	for _, tc := range []struct {
+		opts              sdk.Options
+		budget, maxTokens float64
+	}{
+		// max_tokens grows so the budget fits inside it
+		{sdk.Options{Reasoning: &sdk.Reasoning{BudgetTokens: 2000}, MaxCompletionTokens: 1000}, 2000, 3000},
+		{sdk.Options{Reasoning: &sdk.Reasoning{BudgetTokens: 100}, MaxCompletionTokens: 5000}, 1024, 5000},
+		{sdk.Options{ReasoningEffort: "low"}, 1024, 64000},
+	} {
+		opts := tc.opts
+		opts.Model, opts.Temperature, opts.TopK = "claude-3-7-sonnet-latest", 0.7, 5
+
+		body, _ := anthropicRequest(t, NewAnthropicProvider("key"), []sdk.Message{{Role: "user", Content: "hi"}}, &opts)
+		want := fmt.Sprintf(`{"budget_tokens":%v,"type":"enabled"}`, tc.budget)
+		if got := jsonOf(body["thinking"]); got != want || body["max_tokens"] != tc.maxTokens {
+			t.Errorf("thinking %s max_tokens %v, want %s %v", got, body["max_tokens"], want, tc.maxTokens)
+		}
+		for _, dropped := range []string{"temperature", "top_k", "reasoning_effort"} {
+			if _, ok := body[dropped]; ok {
+				t.Errorf("%s sent with thinking enabled", dropped)
+			}
+		}
+	}
+}
+
+// the content block types and thinking fields of the assistant turn in a request body
+func assistantBlocks(t *testing.T, body string) []string {
+	t.Helper()
+	var req struct {
+		Messages []AnthropicMessage `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	var blocks []string
+	for _, m := range req.Messages {
+		if m.Role != "assistant" {
+			continue
+		}
+		for _, b := range m.Content {
+			blocks = append(blocks, strings.Join(strings.Fields(b.Type+" "+b.Thinking+" "+b.Signature+" "+b.Data), " "))
+		}
+	}
+	return blocks
+}
+
+func TestAnthropicThinkingRoundTrip(t *testing.T) {
+	seq := &sequenceServer{replies: []string{
+		`{"role":"assistant","stop_reason":"tool_use","usage":{"input_tokens":1,"output_tokens":1},"content":[
+			{"type":"thinking","thinking":"need weather","signature":"sig1"},
+			{"type":"redacted_thinking","data":"enc1"},
+			{"type":"tool_use","id":"t1","name":"weather","input":{}}
+		]}`,
+		`{"role":"assistant","stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1},"content":[
+			{"type":"thinking","thinking":"it is sunny","signature":"sig2"},
+			{"type":"text","text":"Sunny."}
+		]}`,
+	}}
+	redirectTo(t, seq.start(t))
+
+	resp := sdk.NewSDK(NewAnthropicProvider("key")).ChatCompletion(context.Background(), &sdk.CompletionRequest{
+		Messages: []sdk.Message{{Role: "user", Content: "weather?"}},
+		Model:    "claude-sonnet-4-20250514",
+		Tools: map[string]sdk.Tool{"weather": {Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			return "sunny", nil
+		}}},
+		Reasoning: &sdk.Reasoning{BudgetTokens: 2000},
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if resp.Content != "Sunny." || strings.Contains(resp.Content, "sunny") {
+		t.Errorf("content = %q, want the thinking kept out", resp.Content)
+	}
+	if !strings.Contains(resp.Reasoning, "it is sunny") {
+		t.Errorf("reasoning = %q", resp.Reasoning)
+	}
+
+	want := []string{"thinking need weather sig1", "redacted_thinking enc1", "tool_use"}
+	if got := assistantBlocks(t, seq.bodies[1]); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("assistant turn sent back as %q, want %q", got, want)
+	}
+}
+
+func TestAnthropicStreamedThinkingRoundTrip(t *testing.T) {
+	seq := &sequenceServer{replies: []string{
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":1,"output_tokens":1}}}
+data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"need "}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"weather"}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig1"}}
+data: {"type":"content_block_stop","index":0}
+data: {"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"enc1"}}
+data: {"type":"content_block_stop","index":1}
+data: {"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"t1","name":"weather","input":{}}}
+data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{}"}}
+data: {"type":"content_block_stop","index":2}
+data: {"type":"message_stop"}
+`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sunny."}}
+data: {"type":"message_stop"}
+`,
+	}}
+	redirectTo(t, seq.start(t))
+
+	var reasoning string
+	resp := sdk.NewSDK(NewAnthropicProvider("key")).ChatCompletion(context.Background(), &sdk.CompletionRequest{
+		Messages: []sdk.Message{{Role: "user", Content: "weather?"}},
+		Model:    "claude-sonnet-4-20250514",
+		Stream:   true,
+		Tools: map[string]sdk.Tool{"weather": {Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			return "sunny", nil
+		}}},
+		Reasoning:   &sdk.Reasoning{BudgetTokens: 2000},
+		OnReasoning: func(s string) { reasoning += s },
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	content, err := io.ReadAll(resp.Stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Sunny." || reasoning != "need weather" {
+		t.Errorf("content %q reasoning %q", content, reasoning)
+	}
+
+	want := []string{"thinking need weather sig1", "redacted_thinking enc1", "tool_use"}
+	if got := assistantBlocks(t, seq.bodies[1]); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("assistant turn sent back as %q, want %q", got, want)
+	}
+}
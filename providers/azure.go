@@ -0,0 +1,115 @@
+// Azure OpenAI provider
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type AzureOpenAIProvider struct {
+	*OpenAICompatibleProvider
+	Endpoint    string          // e.g. https://my-resource.openai.azure.com
+	Deployment  string          // deployment name, the request model is used when empty
+	APIVersion  string          // defaults to 2024-10-21
+	TokenSource sdk.TokenSource // Microsoft Entra ID tokens, used instead of the api-key header when set
+}
+
+func NewAzureOpenAIProvider(endpoint, apiKey string) *AzureOpenAIProvider {
+	p := &AzureOpenAIProvider{
+		OpenAICompatibleProvider: NewOpenAICompatibleProvider(OpenAICompatibleConfig{
+			Name:       "azure",
+			AuthHeader: "api-key",
+			TokenField: "max_completion_tokens",
+			Reasoning:  base.ApplyReasoningEffort,
+		}, apiKey),
+		Endpoint:   strings.TrimRight(endpoint, "/"),
+		APIVersion: "2024-10-21",
+	}
+	p.Provider.APICaller = p
+	return p
+}
+
+// an Azure error body, content filter errors carry the filter results in innererror
+type azureErrorBody struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			Code string `json:"code"`
+		} `json:"innererror"`
+	} `json:"error"`
+}
+
+func (p *AzureOpenAIProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
+	deployment := p.Deployment
+	if deployment == "" && opts != nil {
+		deployment = opts.Model
+	}
+	if deployment == "" {
+		return nil, fmt.Errorf("azure openai requires a deployment or model name")
+	}
+
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		p.Endpoint, url.PathEscape(deployment), url.QueryEscape(p.APIVersion))
+
+	jsonBody, err := json.Marshal(p.requestBody(messages, streamMode, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if p.TokenSource != nil {
+		token, err := p.TokenSource.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get azure token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("api-key", p.ResolveAPIKey(ctx, p.APIKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.Config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.Do(req)
+	if err != nil {
+		return nil, azureContentFilterError(err)
+	}
+
+	return resp.Body, nil
+}
+
+// turns a prompt rejected by the content filter into a ContentBlockedError
+func azureContentFilterError(err error) error {
+	var apiErr *sdk.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+
+	var body azureErrorBody
+	if json.Unmarshal(apiErr.Body, &body) != nil || body.Error.Code != "content_filter" {
+		return err
+	}
+
+	reason := body.Error.InnerError.Code
+	if reason == "" {
+		reason = body.Error.Code
+	}
+	return &sdk.ContentBlockedError{Reason: reason, Body: apiErr.Body}
+}
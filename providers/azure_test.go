@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+// an Azure endpoint that records each request and replies with status and body
+func azureServer(t *testing.T, status int, body string) (*httptest.Server, *[]*http.Request) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+const azureReply = `{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`
+
+func TestAzureDeploymentURLAndKey(t *testing.T) {
+	server, requests := azureServer(t, http.StatusOK, azureReply)
+	p := NewAzureOpenAIProvider(server.URL+"/", "azure-key")
+
+	messages := []sdk.Message{{Role: "user", Content: "hi"}}
+	if _, err := p.CreateCompletion(context.Background(), messages, &sdk.Options{Model: "gpt 4o"}); err != nil {
+		t.Fatal(err)
+	}
+	p.Deployment = "prod"
+	p.APIVersion = "2025-01-01-preview"
+	if _, err := p.CreateCompletion(context.Background(), messages, &sdk.Options{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []struct{ path, version string }{
+		{"/openai/deployments/gpt%204o/chat/completions", "2024-10-21"},
+		{"/openai/deployments/prod/chat/completions", "2025-01-01-preview"},
+	} {
+		req := (*requests)[i]
+		if req.URL.EscapedPath() != want.path || req.URL.Query().Get("api-version") != want.version {
+			t.Errorf("request %d went to %s", i, req.URL)
+		}
+		if req.Header.Get("api-key") != "azure-key" || req.Header.Get("Authorization") != "" {
+			t.Errorf("request %d headers = %v", i, req.Header)
+		}
+	}
+
+	if _, err := NewAzureOpenAIProvider(server.URL, "k").CreateCompletion(context.Background(), messages, &sdk.Options{}); err == nil {
+		t.Error("a request without deployment or model succeeded")
+	}
+}
+
+func TestAzureTokenSource(t *testing.T) {
+	server, requests := azureServer(t, http.StatusOK, azureReply)
+	p := NewAzureOpenAIProvider(server.URL, "unused-key")
+	p.TokenSource = sdk.TokenFunc(func(ctx context.Context) (string, error) { return "entra-token", nil })
+
+	if _, err := p.CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	if req.Header.Get("Authorization") != "Bearer entra-token" || req.Header.Get("api-key") != "" {
+		t.Errorf("headers = %v, want only the bearer token", req.Header)
+	}
+
+	failing := errors.New("no managed identity")
+	p.TokenSource = sdk.TokenFunc(func(ctx context.Context) (string, error) { return "", failing })
+	_, err := p.CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"})
+	if !errors.Is(err, failing) || len(*requests) != 1 {
+		t.Errorf("err = %v after %d requests, want the token error without a request", err, len(*requests))
+	}
+}
+
+func TestAzureContentFilter(t *testing.T) {
+	server, _ := azureServer(t, http.StatusBadRequest, `{"error":{"code":"content_filter","message":"filtered","innererror":{"code":"ResponsibleAIPolicyViolation"}}}`)
+	_, err := NewAzureOpenAIProvider(server.URL, "k").CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"})
+
+	var blocked *sdk.ContentBlockedError
+	if !errors.As(err, &blocked) || blocked.Reason != "ResponsibleAIPolicyViolation" {
+		t.Errorf("err = %v, want a ContentBlockedError with the inner code", err)
+	}
+
+	server, _ = azureServer(t, http.StatusBadRequest, `{"error":{"code":"invalid_request","message":"bad"}}`)
+	_, err = NewAzureOpenAIProvider(server.URL, "k").CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"})
+	var apiErr *sdk.APIError
+	if errors.As(err, &blocked) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("err = %v, want other 400s to stay APIErrors", err)
+	}
+}
@@ -0,0 +1,454 @@
+// AWS Bedrock provider using the Converse API
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type BedrockProvider struct {
+	*base.Provider
+	Region      string
+	Credentials base.AWSCredentialsProvider // defaults to the AWS_* environment variables
+	Endpoint    string                      // overrides https://bedrock-runtime.{region}.amazonaws.com, e.g. for VPC endpoints
+}
+
+// creates a provider for region, an empty region uses AWS_REGION or AWS_DEFAULT_REGION
+func NewBedrockProvider(region string) *BedrockProvider {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	p := &BedrockProvider{
+		Region:      region,
+		Credentials: base.EnvAWSCredentials{},
+	}
+	p.Provider = &base.Provider{APICaller: p, Name: "bedrock"}
+	return p
+}
+
+type BedrockContentBlock struct {
+	Text             string                   `json:"text,omitempty"`
+	ToolUse          *BedrockToolUse          `json:"toolUse,omitempty"`
+	ToolResult       *BedrockToolResult       `json:"toolResult,omitempty"`
+	ReasoningContent *BedrockReasoningContent `json:"reasoningContent,omitempty"`
+}
+
+type BedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type BedrockToolResult struct {
+	ToolUseID string                     `json:"toolUseId"`
+	Content   []BedrockToolResultContent `json:"content"`
+}
+
+type BedrockToolResultContent struct {
+	Text string          `json:"text,omitempty"`
+	JSON json.RawMessage `json:"json,omitempty"`
+}
+
+type BedrockReasoningContent struct {
+	ReasoningText   *BedrockReasoningText `json:"reasoningText,omitempty"`
+	RedactedContent []byte                `json:"redactedContent,omitempty"`
+}
+
+type BedrockReasoningText struct {
+	Text      string `json:"text"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type BedrockMessage struct {
+	Role    string                `json:"role"`
+	Content []BedrockContentBlock `json:"content"`
+}
+
+type BedrockTool struct {
+	ToolSpec BedrockToolSpec `json:"toolSpec"`
+}
+
+type BedrockToolSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type BedrockUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+type BedrockResponse struct {
+	Output struct {
+		Message BedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string        `json:"stopReason"`
+	Usage      *BedrockUsage `json:"usage"`
+}
+
+func (p *BedrockProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
+	if opts == nil || opts.Model == "" {
+		return nil, fmt.Errorf("bedrock requires a model ID")
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", p.Region)
+	}
+	action := "converse"
+	if streamMode {
+		action = "converse-stream"
+	}
+
+	jsonBody, err := json.Marshal(p.requestBody(messages, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(endpoint, "/")+"/model/"+base.AWSURIEncode(opts.Model)+"/"+action, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if streamMode {
+		req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	}
+
+	creds, err := p.Credentials.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aws credentials: %w", err)
+	}
+	if err := base.SignV4(req, creds, p.Region, "bedrock", time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (p *BedrockProvider) requestBody(messages []sdk.Message, opts *sdk.Options) map[string]interface{} {
+	var system []BedrockContentBlock
+	var chat []sdk.Message
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, BedrockContentBlock{Text: m.Content})
+		} else {
+			chat = append(chat, m)
+		}
+	}
+
+	body := map[string]interface{}{
+		"messages": convertBedrockMessages(chat),
+	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+
+	inference := map[string]interface{}{}
+	if opts.MaxCompletionTokens != 0 {
+		inference["maxTokens"] = opts.MaxCompletionTokens
+	}
+
+	// extended thinking is passed through to Claude models, which then reject temperature
+	r := opts.ReasoningConfig()
+	if r != nil && strings.Contains(opts.Model, "anthropic.") {
+		budget := r.Budget()
+		body["additionalModelRequestFields"] = map[string]interface{}{
+			"thinking": map[string]interface{}{"type": "enabled", "budget_tokens": budget},
+		}
+		if opts.MaxCompletionTokens <= budget {
+			inference["maxTokens"] = budget + 4096
+		}
+	} else if opts.Temperature != 0 {
+		inference["temperature"] = opts.Temperature
+	}
+	if len(inference) > 0 {
+		body["inferenceConfig"] = inference
+	}
+
+	if len(opts.Tools) > 0 {
+		toolConfig := map[string]interface{}{"tools": convertBedrockTools(opts.Tools)}
+		switch opts.ToolChoice {
+		case "", sdk.ToolChoiceAuto, sdk.ToolChoiceNone:
+			// converse has no way to disable tools, so none falls back to auto
+		case sdk.ToolChoiceRequired:
+			toolConfig["toolChoice"] = map[string]interface{}{"any": map[string]interface{}{}}
+		default:
+			toolConfig["toolChoice"] = map[string]interface{}{"tool": map[string]interface{}{"name": opts.ToolChoice}}
+		}
+		body["toolConfig"] = toolConfig
+	}
+	return body
+}
+
+func (p *BedrockProvider) ParseCompletion(body []byte) (*sdk.CompletionResponse, error) {
+	var resp BedrockResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse bedrock response: %w", err)
+	}
+
+	if resp.StopReason == "guardrail_intervened" || resp.StopReason == "content_filtered" {
+		return nil, &sdk.ContentBlockedError{Reason: resp.StopReason, Body: body}
+	}
+
+	compResp := &sdk.CompletionResponse{Role: "assistant", Usage: resp.Usage.toSDK()}
+	for _, block := range resp.Output.Message.Content {
+		switch {
+		case block.ToolUse != nil:
+			compResp.ToolCalls = append(compResp.ToolCalls, block.ToolUse.toSDK())
+		case block.ReasoningContent != nil:
+			thinking := block.ReasoningContent.toSDK()
+			compResp.Reasoning += thinking.Text
+			compResp.Thinking = append(compResp.Thinking, thinking)
+		default:
+			compResp.Content += block.Text
+		}
+	}
+	return compResp, nil
+}
+
+// status codes of the exceptions ConverseStream reports inside the stream
+var bedrockStreamStatus = map[string]int{
+	"validationException":         http.StatusBadRequest,
+	"throttlingException":         http.StatusTooManyRequests,
+	"modelStreamErrorException":   http.StatusFailedDependency,
+	"internalServerException":     http.StatusInternalServerError,
+	"serviceUnavailableException": http.StatusServiceUnavailable,
+}
+
+// turns an exception or error frame into an APIError, unknown types count as server errors
+func bedrockStreamError(errorType, message string, payload []byte) error {
+	status, ok := bedrockStreamStatus[errorType]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return &sdk.APIError{StatusCode: status, Message: errorType + ": " + message, Body: payload}
+}
+
+// decodes the binary event stream of ConverseStream
+func (p *BedrockProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
+	toolUses := map[int]*BedrockToolUse{}
+	toolInput := map[int]*strings.Builder{}
+	thinking := map[int]*sdk.ThinkingBlock{}
+
+	for {
+		msg, err := base.ReadEventStreamMessage(body)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg.Header(":message-type") {
+		case "exception":
+			var exc struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(msg.Payload, &exc)
+			return bedrockStreamError(msg.Header(":exception-type"), exc.Message, msg.Payload)
+		case "error":
+			return bedrockStreamError(msg.Header(":error-code"), msg.Header(":error-message"), msg.Payload)
+		}
+
+		var evt struct {
+			ContentBlockIndex int `json:"contentBlockIndex"`
+			Start             struct {
+				ToolUse *BedrockToolUse `json:"toolUse"`
+			} `json:"start"`
+			Delta struct {
+				Text    string `json:"text"`
+				ToolUse *struct {
+					Input string `json:"input"`
+				} `json:"toolUse"`
+				ReasoningContent *struct {
+					Text            string `json:"text"`
+					Signature       string `json:"signature"`
+					RedactedContent []byte `json:"redactedContent"`
+				} `json:"reasoningContent"`
+			} `json:"delta"`
+			StopReason string        `json:"stopReason"`
+			Usage      *BedrockUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(msg.Payload, &evt); err != nil {
+			return fmt.Errorf("failed to parse bedrock stream event: %w", err)
+		}
+
+		i := evt.ContentBlockIndex
+		var out sdk.StreamEvent
+
+		switch msg.Header(":event-type") {
+		case "contentBlockStart":
+			if evt.Start.ToolUse != nil {
+				toolUses[i] = evt.Start.ToolUse
+				toolInput[i] = &strings.Builder{}
+			}
+		case "contentBlockDelta":
+			switch {
+			case evt.Delta.ToolUse != nil:
+				if b, ok := toolInput[i]; ok {
+					b.WriteString(evt.Delta.ToolUse.Input)
+				}
+			case evt.Delta.ReasoningContent != nil:
+				rc := evt.Delta.ReasoningContent
+				if thinking[i] == nil {
+					thinking[i] = &sdk.ThinkingBlock{}
+				}
+				thinking[i].Text += rc.Text
+				thinking[i].Signature += rc.Signature
+				if len(rc.RedactedContent) > 0 {
+					thinking[i].Redacted = string(rc.RedactedContent)
+				}
+				out.Reasoning = rc.Text
+			default:
+				out.Content = evt.Delta.Text
+			}
+		case "contentBlockStop":
+			if tu, ok := toolUses[i]; ok {
+				tu.Input = json.RawMessage(toolInput[i].String())
+				call := tu.toSDK()
+				out.ToolCall = &call
+				delete(toolUses, i)
+				delete(toolInput, i)
+			}
+			if block, ok := thinking[i]; ok {
+				out.Thinking = block
+				delete(thinking, i)
+			}
+		case "messageStop":
+			if evt.StopReason == "guardrail_intervened" || evt.StopReason == "content_filtered" {
+				return &sdk.ContentBlockedError{Reason: evt.StopReason, Body: msg.Payload}
+			}
+		case "metadata":
+			out.Usage = evt.Usage.toSDK()
+		}
+
+		if out.Content != "" || out.Reasoning != "" || out.Thinking != nil || out.ToolCall != nil || out.Usage != nil {
+			if err := onEvent(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (u *BedrockUsage) toSDK() *sdk.Usage {
+	if u == nil {
+		return nil
+	}
+	return &sdk.Usage{
+		PromptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens + u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheWriteInputTokens,
+	}
+}
+
+func (tu *BedrockToolUse) toSDK() sdk.ToolCallRequest {
+	args := tu.Input
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return sdk.ToolCallRequest{ID: tu.ToolUseID, Name: tu.Name, Arguments: args}
+}
+
+func (rc *BedrockReasoningContent) toSDK() sdk.ThinkingBlock {
+	if rc.ReasoningText != nil {
+		return sdk.ThinkingBlock{Text: rc.ReasoningText.Text, Signature: rc.ReasoningText.Signature}
+	}
+	return sdk.ThinkingBlock{Redacted: string(rc.RedactedContent)}
+}
+
+// converts sdk messages, tool results become user messages and turns of the same role are merged
+func convertBedrockMessages(messages []sdk.Message) []BedrockMessage {
+	var out []BedrockMessage
+
+	for _, m := range messages {
+		role := m.Role
+		var blocks []BedrockContentBlock
+
+		if role == "tool" {
+			role = "user"
+			result := &BedrockToolResult{ToolUseID: m.ToolCallID}
+			// tool results are JSON, objects are sent as json content and everything else as text
+			if strings.HasPrefix(strings.TrimSpace(m.Content), "{") && json.Valid([]byte(m.Content)) {
+				result.Content = []BedrockToolResultContent{{JSON: json.RawMessage(m.Content)}}
+			} else {
+				result.Content = []BedrockToolResultContent{{Text: m.Content}}
+			}
+			blocks = append(blocks, BedrockContentBlock{ToolResult: result})
+		} else {
+			for _, t := range m.Thinking {
+				if t.Redacted != "" {
+					blocks = append(blocks, BedrockContentBlock{ReasoningContent: &BedrockReasoningContent{RedactedContent: []byte(t.Redacted)}})
+				} else if t.Signature != "" {
+					blocks = append(blocks, BedrockContentBlock{ReasoningContent: &BedrockReasoningContent{
+						ReasoningText: &BedrockReasoningText{Text: t.Text, Signature: t.Signature},
+					}})
+				}
+			}
+			if m.Content != "" {
+				blocks = append(blocks, BedrockContentBlock{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := tc.Arguments
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, BedrockContentBlock{ToolUse: &BedrockToolUse{ToolUseID: tc.ID, Name: tc.Name, Input: input}})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if len(out) > 0 && out[len(out)-1].Role == role {
+			out[len(out)-1].Content = append(out[len(out)-1].Content, blocks...)
+			continue
+		}
+		out = append(out, BedrockMessage{Role: role, Content: blocks})
+	}
+	return out
+}
+
+// converts sdk tools to converse tool specs sorted by name
+func convertBedrockTools(sdkTools map[string]sdk.Tool) []BedrockTool {
+	names := make([]string, 0, len(sdkTools))
+	for name := range sdkTools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]BedrockTool, 0, len(names))
+	for _, name := range names {
+		tool := sdkTools[name]
+		tools = append(tools, BedrockTool{ToolSpec: BedrockToolSpec{
+			Name:        name,
+			Description: tool.Description,
+			InputSchema: map[string]any{"json": tool.Schema()},
+		}})
+	}
+	return tools
+}
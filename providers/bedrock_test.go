@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+const bedrockModel = "anthropic.claude-3-haiku-20240307-v1:0"
+
+var bedrockCreds = base.AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}
+
+// checks that a request reached the server with a signature the same credentials reproduce
+func checkBedrockSignature(t *testing.T, r *http.Request, body []byte) {
+	t.Helper()
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatalf("X-Amz-Date: %v", err)
+	}
+
+	want, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+	want.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	if err := base.SignV4(want, bedrockCreds, "us-west-2", "bedrock", signedAt); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Header.Get("Authorization"); got != want.Header.Get("Authorization") {
+		t.Errorf("Authorization = %s\nwant %s", got, want.Header.Get("Authorization"))
+	}
+	if r.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("session token not sent")
+	}
+}
+
+func bedrockServer(t *testing.T, wantPath string, reply func(w http.ResponseWriter)) *BedrockProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.EscapedPath() != wantPath {
+			t.Errorf("path = %s, want %s", r.URL.EscapedPath(), wantPath)
+		}
+		checkBedrockSignature(t, r, body)
+		reply(w)
+	}))
+	t.Cleanup(server.Close)
+
+	p := NewBedrockProvider("us-west-2")
+	p.Credentials = bedrockCreds
+	p.Endpoint = server.URL + "/"
+	return p
+}
+
+func TestBedrockConverseRoundTrip(t *testing.T) {
+	p := bedrockServer(t, "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse", func(w http.ResponseWriter) {
+		io.WriteString(w, `{
+			"output": {"message": {"role": "assistant", "content": [
+				{"text": "Let me check."},
+				{"toolUse": {"toolUseId": "t1", "name": "weather", "input": {"city": "Oslo"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 10, "outputTokens": 4, "totalTokens": 14}
+		}`)
+	})
+
+	resp, err := p.CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "weather?"}}, &sdk.Options{Model: bedrockModel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Let me check." {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "t1" || string(resp.ToolCalls[0].Arguments) != `{"city": "Oslo"}` {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 14 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+// frames one ConverseStream event
+func bedrockEvent(eventType, payload string) []byte {
+	return bedrockFrame(payload, [2]string{":event-type", eventType}, [2]string{":message-type", "event"})
+}
+
+// frames payload with string headers
+func bedrockFrame(payload string, stringHeaders ...[2]string) []byte {
+	var headers bytes.Buffer
+	for _, h := range stringHeaders {
+		headers.WriteByte(byte(len(h[0])))
+		headers.WriteString(h[0])
+		headers.WriteByte(7)
+		binary.Write(&headers, binary.BigEndian, uint16(len(h[1])))
+		headers.WriteString(h[1])
+	}
+
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.BigEndian, uint32(12+headers.Len()+len(payload)+4))
+	binary.Write(&msg, binary.BigEndian, uint32(headers.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(headers.Bytes())
+	msg.WriteString(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func TestBedrockConverseStreamRoundTrip(t *testing.T) {
+	p := bedrockServer(t, "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse-stream", func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, frame := range [][]byte{
+			bedrockEvent("messageStart", `{"role":"assistant"}`),
+			bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Let me "}}`),
+			bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"check."}}`),
+			bedrockEvent("contentBlockStop", `{"contentBlockIndex":0}`),
+			bedrockEvent("contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"t1","name":"weather"}}}`),
+			bedrockEvent("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\":"}}}`),
+			bedrockEvent("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"Oslo\"}"}}}`),
+			bedrockEvent("contentBlockStop", `{"contentBlockIndex":1}`),
+			bedrockEvent("messageStop", `{"stopReason":"tool_use"}`),
+			bedrockEvent("metadata", `{"usage":{"inputTokens":10,"outputTokens":4,"totalTokens":14}}`),
+		} {
+			w.Write(frame)
+		}
+	})
+
+	stream, err := p.CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "weather?"}}, &sdk.Options{Model: bedrockModel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Let me check." {
+		t.Errorf("content = %q", content)
+	}
+
+	result := stream.(sdk.StreamResult).Result()
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Name != "weather" || string(result.ToolCalls[0].Arguments) != `{"city":"Oslo"}` {
+		t.Errorf("tool calls = %+v", result.ToolCalls)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 14 {
+		t.Errorf("usage = %+v", result.Usage)
+	}
+}
+
+func TestBedrockStreamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		frame   []byte
+		status  int
+		message string
+	}{
+		{"exception", bedrockFrame(`{"message":"Too many tokens, please wait."}`,
+			[2]string{":exception-type", "throttlingException"}, [2]string{":message-type", "exception"}),
+			http.StatusTooManyRequests, "throttlingException: Too many tokens, please wait."},
+		{"error", bedrockFrame(``,
+			[2]string{":error-code", "InternalFailure"}, [2]string{":error-message", "Model failed."}, [2]string{":message-type", "error"}),
+			http.StatusInternalServerError, "InternalFailure: Model failed."},
+	} {
+		p := bedrockServer(t, "/model/m/converse-stream", func(w http.ResponseWriter) {
+			w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"partial"}}`))
+			w.Write(tc.frame)
+			w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":" never sent"}}`))
+		})
+
+		stream, err := p.CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(stream)
+		if string(content) != "partial" {
+			t.Errorf("%s: content = %q", tc.name, content)
+		}
+
+		var apiErr *sdk.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.status || apiErr.Message != tc.message {
+			t.Errorf("%s: err = %v, want an APIError %d %q", tc.name, err, tc.status, tc.message)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Cohere provider using the chat v2 API
+
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type CohereProvider struct {
+	*base.Provider
+	APIKey string
+}
+
+func NewCohereProvider(apiKey string) *CohereProvider {
+	p := &CohereProvider{
+		APIKey: apiKey,
+	}
+	p.Provider = &base.Provider{APICaller: p, Name: "cohere"}
+	return p
+}
+
+type CohereContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+type CohereCitation struct {
+	Start   int                    `json:"start"`
+	End     int                    `json:"end"`
+	Text    string                 `json:"text"`
+	Sources []CohereCitationSource `json:"sources"`
+}
+
+type CohereCitationSource struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type CohereUsage struct {
+	BilledUnits struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"billed_units"`
+	Tokens struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"tokens"`
+}
+
+type CohereResponse struct {
+	FinishReason string `json:"finish_reason"`
+	Message      struct {
+		Role      string           `json:"role"`
+		Content   []CohereContent  `json:"content"`
+		ToolPlan  string           `json:"tool_plan"`
+		ToolCalls []cohereToolCall `json:"tool_calls"`
+		Citations []CohereCitation `json:"citations"`
+	} `json:"message"`
+	Usage *CohereUsage `json:"usage"`
+}
+
+type cohereToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func (p *CohereProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
+	url := "https://api.cohere.com/v2/chat"
+
+	body := map[string]interface{}{
+		"messages": base.OpenAiMessages(messages),
+		"stream":   streamMode,
+	}
+	if opts != nil {
+		if opts.Model != "" {
+			body["model"] = opts.Model
+		}
+		if opts.MaxCompletionTokens != 0 {
+			body["max_tokens"] = opts.MaxCompletionTokens
+		}
+		if opts.Temperature != 0 {
+			body["temperature"] = opts.Temperature
+		}
+		if r := opts.ReasoningConfig(); r != nil {
+			body["thinking"] = map[string]interface{}{"type": "enabled", "token_budget": r.Budget()}
+		}
+		if len(opts.Documents) > 0 {
+			body["documents"] = opts.Documents
+		}
+		if len(opts.Tools) > 0 {
+			tools := opts.Tools
+			switch opts.ToolChoice {
+			case "", sdk.ToolChoiceAuto:
+			case sdk.ToolChoiceNone:
+				body["tool_choice"] = "NONE"
+			case sdk.ToolChoiceRequired:
+				body["tool_choice"] = "REQUIRED"
+			default:
+				// cohere cannot force a named tool, so only that tool is offered and a call is required
+				if tool, ok := opts.Tools[opts.ToolChoice]; ok {
+					tools = map[string]sdk.Tool{opts.ToolChoice: tool}
+				}
+				body["tool_choice"] = "REQUIRED"
+			}
+			body["tools"] = base.OpenAiTools(tools)
+		}
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.ResolveAPIKey(ctx, p.APIKey))
+	req.Header.Set("Content-Type", "application/json")
+	if streamMode {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := p.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (p *CohereProvider) ParseCompletion(body []byte) (*sdk.CompletionResponse, error) {
+	var resp CohereResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse cohere response: %w", err)
+	}
+
+	compResp := &sdk.CompletionResponse{Role: "assistant", Usage: resp.Usage.toSDK()}
+	for _, c := range resp.Message.Content {
+		switch c.Type {
+		case "text":
+			compResp.Content += c.Text
+		case "thinking":
+			compResp.Reasoning += c.Thinking
+		}
+	}
+	// the tool plan explains the tool calls that follow, it is kept as reasoning
+	if resp.Message.ToolPlan != "" {
+		compResp.Reasoning += resp.Message.ToolPlan
+	}
+	for _, tc := range resp.Message.ToolCalls {
+		compResp.ToolCalls = append(compResp.ToolCalls, tc.toSDK())
+	}
+	for _, c := range resp.Message.Citations {
+		compResp.Citations = append(compResp.Citations, c.toSDK())
+	}
+	return compResp, nil
+}
+
+// reads the server sent events of a chat v2 stream
+func (p *CohereProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
+	reader := bufio.NewReader(body)
+	var pending *cohereToolCall
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); bytes.HasPrefix(line, []byte("data:")) {
+			line = bytes.TrimSpace(line[len("data:"):])
+
+			var evt struct {
+				Type  string `json:"type"`
+				Delta struct {
+					FinishReason string       `json:"finish_reason"`
+					Usage        *CohereUsage `json:"usage"`
+					Message      struct {
+						Content struct {
+							Text     string `json:"text"`
+							Thinking string `json:"thinking"`
+						} `json:"content"`
+						ToolPlan  string          `json:"tool_plan"`
+						ToolCalls *cohereToolCall `json:"tool_calls"`
+						Citations *CohereCitation `json:"citations"`
+					} `json:"message"`
+				} `json:"delta"`
+			}
+			if jsonErr := json.Unmarshal(line, &evt); jsonErr != nil {
+				return fmt.Errorf("failed to parse cohere stream event: %w", jsonErr)
+			}
+
+			msg := evt.Delta.Message
+			var out sdk.StreamEvent
+
+			switch evt.Type {
+			case "content-delta":
+				out.Content = msg.Content.Text
+				out.Reasoning = msg.Content.Thinking
+			case "tool-plan-delta":
+				out.Reasoning = msg.ToolPlan
+			case "tool-call-start":
+				pending = msg.ToolCalls
+			case "tool-call-delta":
+				if pending != nil && msg.ToolCalls != nil {
+					pending.Function.Arguments += msg.ToolCalls.Function.Arguments
+				}
+			case "tool-call-end":
+				if pending != nil {
+					call := pending.toSDK()
+					out.ToolCall = &call
+					pending = nil
+				}
+			case "citation-start":
+				if msg.Citations != nil {
+					citation := msg.Citations.toSDK()
+					out.Citation = &citation
+				}
+			case "message-end":
+				out.Usage = evt.Delta.Usage.toSDK()
+			}
+
+			if out.Content != "" || out.Reasoning != "" || out.ToolCall != nil || out.Citation != nil || out.Usage != nil {
+				if evtErr := onEvent(out); evtErr != nil {
+					return evtErr
+				}
+			}
+			if evt.Type == "message-end" {
+				return nil
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// prefers the token counts, falling back to billed units
+func (u *CohereUsage) toSDK() *sdk.Usage {
+	if u == nil {
+		return nil
+	}
+	input, output := u.Tokens.InputTokens, u.Tokens.OutputTokens
+	if input == 0 && output == 0 {
+		input, output = u.BilledUnits.InputTokens, u.BilledUnits.OutputTokens
+	}
+	return &sdk.Usage{PromptTokens: input, CompletionTokens: output, TotalTokens: input + output}
+}
+
+func (tc *cohereToolCall) toSDK() sdk.ToolCallRequest {
+	args := tc.Function.Arguments
+	if args == "" {
+		args = "{}"
+	}
+	return sdk.ToolCallRequest{ID: tc.ID, Name: tc.Function.Name, Arguments: json.RawMessage(args)}
+}
+
+func (c *CohereCitation) toSDK() sdk.Citation {
+	citation := sdk.Citation{Start: c.Start, End: c.End, Text: c.Text}
+	for _, s := range c.Sources {
+		if s.ID != "" {
+			citation.DocumentIDs = append(citation.DocumentIDs, s.ID)
+		}
+	}
+	return citation
+}
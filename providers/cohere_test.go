@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func TestCohereCompletion(t *testing.T) {
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, `{
+		"finish_reason": "TOOL_CALL",
+		"message": {
+			"role": "assistant",
+			"content": [{"type": "thinking", "thinking": "look it up. "}, {"type": "text", "text": "Die Brücke öffnete 1932."}],
+			"tool_plan": "I will check the weather.",
+			"tool_calls": [{"id": "tc1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Oslo\"}"}}],
+			"citations": [{"start": 19, "end": 23, "text": "1932", "sources": [{"type": "document", "id": "doc1"}, {"type": "tool"}]}]
+		},
+		"usage": {"billed_units": {"input_tokens": 3, "output_tokens": 2}, "tokens": {"input_tokens": 30, "output_tokens": 12}}
+	}`))
+
+	resp, err := NewCohereProvider("key").CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "when?"}}, &sdk.Options{
+		Model:      "command-a-03-2025",
+		Documents:  []sdk.Document{{ID: "doc1", Data: map[string]string{"snippet": "The bridge opened in 1932."}}},
+		Tools:      map[string]sdk.Tool{"weather": {Description: "weather"}, "time": {Description: "time"}},
+		ToolChoice: "weather",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Content != "Die Brücke öffnete 1932." || resp.Reasoning != "look it up. I will check the weather." {
+		t.Errorf("content %q reasoning %q", resp.Content, resp.Reasoning)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "tc1" || string(resp.ToolCalls[0].Arguments) != `{"city":"Oslo"}` {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if len(resp.Citations) != 1 || resp.Citations[0].Text != "1932" || len(resp.Citations[0].DocumentIDs) != 1 {
+		t.Fatalf("citations = %+v", resp.Citations)
+	}
+	// the offsets count characters, so they only match the text when sliced as runes
+	c := resp.Citations[0]
+	if got := string([]rune(resp.Content)[c.Start:c.End]); got != c.Text || utf8.RuneCountInString(resp.Content) == len(resp.Content) {
+		t.Errorf("rune slice %q, want %q", got, c.Text)
+	}
+	if u := resp.Usage; u == nil || u.PromptTokens != 30 || u.CompletionTokens != 12 {
+		t.Errorf("usage = %+v, want the token counts over billed units", u)
+	}
+
+	var body struct {
+		Documents  []sdk.Document `json:"documents"`
+		ToolChoice string         `json:"tool_choice"`
+		Tools      []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Documents) != 1 || body.ToolChoice != "REQUIRED" || len(body.Tools) != 1 || body.Tools[0].Function.Name != "weather" {
+		t.Errorf("request = %s", rec.bodies[0])
+	}
+}
+
+func TestCohereStream(t *testing.T) {
+	redirectTo(t, (&recorder{}).server(t, `event: message-start
+data: {"type":"message-start","delta":{"message":{"role":"assistant"}}}
+
+data: {"type":"tool-plan-delta","delta":{"message":{"tool_plan":"Checking."}}}
+
+data: {"type":"tool-call-start","index":0,"delta":{"message":{"tool_calls":{"id":"tc1","type":"function","function":{"name":"weather","arguments":""}}}}}
+
+data: {"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"{\"city\":"}}}}}
+
+data: {"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"\"Oslo\"}"}}}}}
+
+data: {"type":"tool-call-end","index":0}
+
+data: {"type":"content-delta","index":0,"delta":{"message":{"content":{"text":"Opened in 1932."}}}}
+
+data: {"type":"citation-start","index":0,"delta":{"message":{"citations":{"start":10,"end":14,"text":"1932","sources":[{"type":"document","id":"doc1"}]}}}}
+
+data: {"type":"citation-end","index":0}
+
+data: {"type":"message-end","delta":{"finish_reason":"COMPLETE","usage":{"billed_units":{"input_tokens":5,"output_tokens":7}}}}
+
+data: {"type":"content-delta","delta":{"message":{"content":{"text":" after the end"}}}}
+`))
+
+	stream, err := NewCohereProvider("key").CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "when?"}}, &sdk.Options{Model: "command-a-03-2025"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Opened in 1932." {
+		t.Errorf("content = %q, want the stream to end at message-end", content)
+	}
+
+	result := stream.(sdk.StreamResult).Result()
+	if result.Reasoning != "Checking." {
+		t.Errorf("reasoning = %q", result.Reasoning)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].ID != "tc1" || result.ToolCalls[0].Name != "weather" || string(result.ToolCalls[0].Arguments) != `{"city":"Oslo"}` {
+		t.Errorf("tool calls = %+v", result.ToolCalls)
+	}
+	if len(result.Citations) != 1 || result.Citations[0].Start != 10 || result.Citations[0].DocumentIDs[0] != "doc1" {
+		t.Errorf("citations = %+v", result.Citations)
+	}
+	if u := result.Usage; u == nil || u.PromptTokens != 5 || u.CompletionTokens != 7 || u.TotalTokens != 12 {
+		t.Errorf("usage = %+v, want the billed units", u)
+	}
+}
+
+func TestCohereToolChoice(t *testing.T) {
+	no := false
+	for _, tc := range []struct {
+		choice, want string
+		tools        int
+	}{
+		{"", "null", 2},
+		{"none", `"NONE"`, 2},
+		{"required", `"REQUIRED"`, 2},
+		{"weather", `"REQUIRED"`, 1},
+	} {
+		// cohere has no switch for parallel calls, so it is left out of the request
+		body := toolChoiceBody(t, NewCohereProvider("key"), `{"message":{"role":"assistant","content":[{"type":"text","text":"ok"}]}}`, tc.choice, &no)
+		tools, _ := body["tools"].([]any)
+		if got := jsonOf(body["tool_choice"]); got != tc.want || len(tools) != tc.tools {
+			t.Errorf("%q: tool_choice %s with %d tools, want %s with %d", tc.choice, got, len(tools), tc.want, tc.tools)
+		}
+		if _, ok := body["parallel_tool_calls"]; ok {
+			t.Errorf("%q: parallel_tool_calls was sent", tc.choice)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/unsafe0x0/ai/v2/base"
 	"github.com/unsafe0x0/ai/v2/sdk"
@@ -17,21 +19,25 @@ import (
 
 type GeminiProvider struct {
 	*base.Provider
-	APIKey string
+	APIKey           string
+	Vertex           *GeminiVertexConfig   // when set, requests go to Vertex AI with OAuth tokens instead of the API key
+	SafetySettings   []GeminiSafetySetting // block thresholds per harm category, sent with every request
+	GenerationConfig *GenerationConfig     // defaults for every request, request options override them
 }
 
 func NewGeminiProvider(apiKey string) *GeminiProvider {
 	p := &GeminiProvider{
 		APIKey: apiKey,
 	}
-	p.Provider = &base.Provider{APICaller: p}
+	p.Provider = &base.Provider{APICaller: p, Name: "gemini"}
 	return p
 }
 
 type GeminiFunctionDeclaration struct {
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Parameters  *GeminiParameters `json:"parameters,omitempty"`
+	Name                 string            `json:"name"`
+	Description          string            `json:"description"`
+	Parameters           *GeminiParameters `json:"parameters,omitempty"`
+	ParametersJSONSchema json.RawMessage   `json:"parametersJsonSchema,omitempty"` // a full JSON schema, used instead of Parameters
 }
 
 type GeminiParameters struct {
@@ -41,26 +47,43 @@ type GeminiParameters struct {
 }
 
 type GeminiPropertyDef struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
+	Type        string                       `json:"type"`
+	Description string                       `json:"description,omitempty"`
+	Enum        []string                     `json:"enum,omitempty"`
+	Items       *GeminiPropertyDef           `json:"items,omitempty"`
+	Properties  map[string]GeminiPropertyDef `json:"properties,omitempty"`
+	Required    []string                     `json:"required,omitempty"`
 }
 
 type GeminiToolConfig struct {
 	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
 }
 
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type GeminiToolChoiceConfig struct {
+	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
 type GeminiPart struct {
 	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
 	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
 }
 
 type GeminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
 	Name     string         `json:"name"`
 	Response map[string]any `json:"response"`
 }
 
 type GeminiFunctionCall struct {
+	ID   string         `json:"id,omitempty"` // set by gemini on some models, otherwise synthesized for the sdk
 	Name string         `json:"name"`
 	Args map[string]any `json:"args"`
 }
@@ -71,43 +94,89 @@ type GeminiContent struct {
 }
 
 type GenerationConfig struct {
-	Temperature     float32 `json:"temperature,omitempty"`
-	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+	Temperature        float32               `json:"temperature,omitempty"`
+	TopP               float32               `json:"topP,omitempty"`
+	TopK               int                   `json:"topK,omitempty"`
+	CandidateCount     int                   `json:"candidateCount,omitempty"` // only the first candidate is returned
+	MaxOutputTokens    int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences      []string              `json:"stopSequences,omitempty"`
+	Seed               *int                  `json:"seed,omitempty"`
+	PresencePenalty    float32               `json:"presencePenalty,omitempty"`
+	FrequencyPenalty   float32               `json:"frequencyPenalty,omitempty"`
+	ResponseModalities []string              `json:"responseModalities,omitempty"` // e.g. "TEXT", "IMAGE"
+	ThinkingConfig     *GeminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// harm categories and block thresholds for safety settings
+const (
+	HarmCategoryHarassment       = "HARM_CATEGORY_HARASSMENT"
+	HarmCategoryHateSpeech       = "HARM_CATEGORY_HATE_SPEECH"
+	HarmCategorySexuallyExplicit = "HARM_CATEGORY_SEXUALLY_EXPLICIT"
+	HarmCategoryDangerousContent = "HARM_CATEGORY_DANGEROUS_CONTENT"
+	HarmCategoryCivicIntegrity   = "HARM_CATEGORY_CIVIC_INTEGRITY"
+
+	HarmBlockNone           = "BLOCK_NONE"
+	HarmBlockOnlyHigh       = "BLOCK_ONLY_HIGH"
+	HarmBlockMediumAndAbove = "BLOCK_MEDIUM_AND_ABOVE"
+	HarmBlockLowAndAbove    = "BLOCK_LOW_AND_ABOVE"
+	HarmBlockOff            = "OFF"
+)
+
+type GeminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// returned on responses as Safety and on blocked requests in ContentBlockedError
+type GeminiSafetyRating = sdk.SafetyRating
+
+type GeminiThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
 }
 
 type GeminiRequest struct {
-	Contents          []GeminiContent   `json:"contents"`
-	SystemInstruction *GeminiContent    `json:"system_instruction,omitempty"`
-	GenerationConfig  *GenerationConfig `json:"generation_config,omitempty"`
-	Tools             *GeminiToolConfig `json:"tools,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"system_instruction,omitempty"`
+	GenerationConfig  *GenerationConfig       `json:"generation_config,omitempty"`
+	SafetySettings    []GeminiSafetySetting   `json:"safetySettings,omitempty"`
+	Tools             *GeminiToolConfig       `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolChoiceConfig `json:"toolConfig,omitempty"`
 }
 
 type Candidate struct {
-	Content      GeminiContent `json:"content"`
-	FinishReason string        `json:"finishReason"`
+	Content       GeminiContent        `json:"content"`
+	FinishReason  string               `json:"finishReason"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type GeminiResponseChunk struct {
-	Candidates []Candidate `json:"candidates"`
+	Candidates     []Candidate          `json:"candidates"`
+	PromptFeedback *PromptFeedback      `json:"promptFeedback,omitempty"`
+	UsageMetadata  *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
 }
 
 type PromptFeedback struct {
-	BlockReason string `json:"blockReason"`
+	BlockReason   string               `json:"blockReason"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
 }
 
-type GeminiResponse struct {
-	Candidates     []Candidate     `json:"candidates"`
-	PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
+type GeminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
 }
 
-type ContentBlockedError struct {
-	Reason string
-	Body   []byte
+type GeminiResponse struct {
+	Candidates     []Candidate          `json:"candidates"`
+	PromptFeedback *PromptFeedback      `json:"promptFeedback,omitempty"`
+	UsageMetadata  *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
 }
 
-func (e *ContentBlockedError) Error() string {
-	return fmt.Sprintf("content blocked by safety filters. Finish Reason: %s. Response Body: %s", e.Reason, string(e.Body))
-}
+// kept here for code written before the error moved to sdk
+type ContentBlockedError = sdk.ContentBlockedError
 
 func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
 
@@ -117,14 +186,21 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 	}
 
 	var url string
-	if streamMode {
-		url = fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", model, p.APIKey)
-	} else {
-		url = fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, p.APIKey)
+	switch {
+	case p.Vertex != nil:
+		url = p.Vertex.url(model, streamMode)
+	case streamMode:
+		url = fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse", model)
+	default:
+		url = fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", model)
 	}
 
 	var systemInstruction *GeminiContent
 	var geminiContents []GeminiContent
+	// the calls of the last model turn, a function response is matched to its call by id,
+	// or else to the first call that has no response yet
+	var turnCalls []sdk.ToolCallRequest
+	var answered []bool
 
 	for _, msg := range messages {
 		role := msg.Role
@@ -145,26 +221,22 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 				response = map[string]any{"result": msg.Content}
 			}
 
-			functionName := ""
-			if len(geminiContents) > 0 {
-				lastContent := geminiContents[len(geminiContents)-1]
-				for _, part := range lastContent.Parts {
-					if part.FunctionCall != nil {
-						functionName = part.FunctionCall.Name
-						break
-					}
-				}
+			call := matchFunctionCall(turnCalls, answered, msg.ToolCallID)
+
+			part := GeminiPart{
+				FunctionResponse: &GeminiFunctionResponse{
+					ID:       geminiIssuedID(call.ID),
+					Name:     call.Name,
+					Response: response,
+				},
 			}
 
-			geminiContents = append(geminiContents, GeminiContent{
-				Role: "function",
-				Parts: []GeminiPart{{
-					FunctionResponse: &GeminiFunctionResponse{
-						Name:     functionName,
-						Response: response,
-					},
-				}},
-			})
+			// responses to parallel calls go back together in one turn
+			if last := len(geminiContents) - 1; last >= 0 && geminiContents[last].Role == "function" {
+				geminiContents[last].Parts = append(geminiContents[last].Parts, part)
+			} else {
+				geminiContents = append(geminiContents, GeminiContent{Role: "function", Parts: []GeminiPart{part}})
+			}
 			continue
 		}
 		var parts []GeminiPart
@@ -174,6 +246,8 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 		}
 
 		if len(msg.ToolCalls) > 0 {
+			turnCalls = msg.ToolCalls
+			answered = make([]bool, len(msg.ToolCalls))
 			for _, toolCall := range msg.ToolCalls {
 				var args map[string]any
 				if err := json.Unmarshal(toolCall.Arguments, &args); err != nil {
@@ -182,6 +256,7 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 
 				parts = append(parts, GeminiPart{
 					FunctionCall: &GeminiFunctionCall{
+						ID:   geminiIssuedID(toolCall.ID),
 						Name: toolCall.Name,
 						Args: args,
 					},
@@ -189,6 +264,24 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 			}
 		}
 
+		// thought signatures go back on the first function call, or the first part when there is none
+		if len(parts) > 0 {
+			for _, t := range msg.Thinking {
+				if t.Signature == "" {
+					continue
+				}
+				i := 0
+				for j, part := range parts {
+					if part.FunctionCall != nil {
+						i = j
+						break
+					}
+				}
+				parts[i].ThoughtSignature = t.Signature
+				break
+			}
+		}
+
 		if len(parts) > 0 {
 			geminiContents = append(geminiContents, GeminiContent{
 				Role:  role,
@@ -202,24 +295,48 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 		SystemInstruction: systemInstruction,
 	}
 
-	if opts != nil {
-		cfg := &GenerationConfig{}
-		cfg.Temperature = 0.7
+	cfg := &GenerationConfig{}
+	if p.GenerationConfig != nil {
+		*cfg = *p.GenerationConfig
+	}
+	reqBody.GenerationConfig = cfg
+	reqBody.SafetySettings = p.SafetySettings
 
+	if opts != nil {
 		if opts.Temperature > 0 {
 			cfg.Temperature = opts.Temperature
 		}
+		if opts.TopP > 0 {
+			cfg.TopP = opts.TopP
+		}
+		if opts.TopK > 0 {
+			cfg.TopK = opts.TopK
+		}
+		if len(opts.StopSequences) > 0 {
+			cfg.StopSequences = opts.StopSequences
+		}
 
 		if opts.MaxCompletionTokens > 0 {
 			cfg.MaxOutputTokens = opts.MaxCompletionTokens
 		}
 
+		if r := opts.ReasoningConfig(); r != nil {
+			cfg.ThinkingConfig = &GeminiThinkingConfig{
+				ThinkingBudget:  r.Budget(),
+				IncludeThoughts: !r.Exclude,
+			}
+		}
+
 		if len(opts.Tools) > 0 {
 			toolConfig := convertSDKToolsToProviderTools(opts.Tools)
 			reqBody.Tools = toolConfig
-		}
 
-		reqBody.GenerationConfig = cfg
+			if opts.ToolChoice != "" {
+				reqBody.ToolConfig = &GeminiToolChoiceConfig{
+					FunctionCallingConfig: geminiFunctionCallingConfig(opts.ToolChoice),
+				}
+			}
+		}
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -233,151 +350,239 @@ func (p *GeminiProvider) CallAPI(ctx context.Context, messages []sdk.Message, st
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if p.Vertex != nil {
+		if err := p.Vertex.authorize(ctx, req); err != nil {
+			return nil, err
+		}
+	} else {
+		req.Header.Set("x-goog-api-key", p.ResolveAPIKey(ctx, p.APIKey))
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, &sdk.APIError{
-			StatusCode: resp.StatusCode,
-			Message:    string(b),
-			Body:       b,
-		}
-	}
+	return resp.Body, nil
+}
 
-	if !streamMode {
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+func (p *GeminiProvider) ParseCompletion(body []byte) (*sdk.CompletionResponse, error) {
+	var response GeminiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse non-streaming JSON response: %w. Body: %s", err, string(body))
+	}
 
-		var response GeminiResponse
-		if err := json.Unmarshal(body, &response); err != nil {
-			return nil, fmt.Errorf("failed to parse non-streaming JSON response: %w. Body: %s", err, string(body))
-		}
+	safety := safetyRatings(response.PromptFeedback, response.Candidates)
 
-		if response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
-			return nil, &ContentBlockedError{
-				Reason: response.PromptFeedback.BlockReason,
-				Body:   body,
-			}
+	if response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
+		return nil, &ContentBlockedError{
+			Reason: response.PromptFeedback.BlockReason,
+			Body:   body,
+			Safety: safety,
 		}
+	}
 
-		if len(response.Candidates) > 0 {
-			candidate := response.Candidates[0]
-
-			if candidate.FinishReason == "SAFETY" || candidate.FinishReason == "RECITATION" {
-				return nil, &ContentBlockedError{
-					Reason: candidate.FinishReason,
-					Body:   body,
-				}
-			}
-
-			var fullText string
-			var toolCalls []sdk.ToolCallRequest
-			for i, part := range candidate.Content.Parts {
-				if part.Text != "" {
-					fullText += part.Text
-				}
+	if len(response.Candidates) == 0 {
+		return nil, fmt.Errorf("non-streaming response body was successfully parsed but contained no candidates. Raw body: %s", string(body))
+	}
 
-				if part.FunctionCall != nil {
-					argsJSON, err := json.Marshal(part.FunctionCall.Args)
-					if err != nil {
-						return nil, fmt.Errorf("failed to marshal function call args: %w", err)
-					}
+	candidate := response.Candidates[0]
 
-					toolCalls = append(toolCalls, sdk.ToolCallRequest{
-						ID:        fmt.Sprintf("call_%d", i),
-						Name:      part.FunctionCall.Name,
-						Arguments: json.RawMessage(argsJSON),
-					})
-				}
-			}
+	if candidate.FinishReason == "SAFETY" || candidate.FinishReason == "RECITATION" {
+		return nil, &ContentBlockedError{
+			Reason: candidate.FinishReason,
+			Body:   body,
+			Safety: safety,
+		}
+	}
 
-			if len(toolCalls) > 0 {
-				response := &sdk.CompletionResponse{
-					Content:   fullText,
-					ToolCalls: toolCalls,
-					Role:      "assistant",
-				}
-				responseJSON, err := json.Marshal(response)
-				if err != nil {
-					return nil, fmt.Errorf("failed to marshal completion response: %w", err)
-				}
-				return io.NopCloser(bytes.NewReader(responseJSON)), nil
-			}
+	compResp := &sdk.CompletionResponse{Role: "assistant", Safety: safety, Usage: response.UsageMetadata.toSDK()}
+	for _, part := range candidate.Content.Parts {
+		if part.ThoughtSignature != "" {
+			compResp.Thinking = append(compResp.Thinking, sdk.ThinkingBlock{Signature: part.ThoughtSignature})
+		}
 
-			if fullText == "" {
+		if part.Thought {
+			compResp.Reasoning += part.Text
+		} else if part.Text != "" {
+			compResp.Content += part.Text
+		}
 
-				return nil, fmt.Errorf("non-streaming response body was successfully parsed but contained empty text (FinishReason: %s). Raw body: %s", candidate.FinishReason, string(body))
+		if part.FunctionCall != nil {
+			call, err := part.FunctionCall.toSDK(len(compResp.ToolCalls))
+			if err != nil {
+				return nil, err
 			}
-
-			return io.NopCloser(bytes.NewReader([]byte(fullText))), nil
+			compResp.ToolCalls = append(compResp.ToolCalls, call)
 		}
+	}
 
-		return nil, fmt.Errorf("non-streaming response body was successfully parsed but contained no candidates. Raw body: %s", string(body))
+	if compResp.Content == "" && len(compResp.ToolCalls) == 0 {
+		return nil, fmt.Errorf("non-streaming response body was successfully parsed but contained empty text (FinishReason: %s). Raw body: %s", candidate.FinishReason, string(body))
 	}
 
-	return resp.Body, nil
+	return compResp, nil
 }
 
+// streams only the content text, kept for callers of the StreamParser interface
 func (p *GeminiProvider) ParseResponse(body io.Reader, onChunk func(string) error) error {
+	return base.ParseContent(p, body, onChunk)
+}
+
+// reads every part of every chunk until the stream ends, usage is reported once at the end
+func (p *GeminiProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
 	reader := bufio.NewReader(body)
+	var usage *GeminiUsageMetadata
+	var promptFeedback *PromptFeedback
+	calls := 0
 
 	for {
 		line, err := reader.ReadBytes('\n')
-		if len(line) > 0 {
-			line = bytes.TrimSpace(line)
-			if len(line) == 0 {
-				continue
+		if line = bytes.TrimSpace(line); bytes.HasPrefix(line, []byte("data:")) {
+			line = bytes.TrimSpace(line[len("data:"):])
+
+			var chunk GeminiResponseChunk
+			if jsonErr := json.Unmarshal(line, &chunk); jsonErr != nil {
+				return fmt.Errorf("failed to parse gemini stream chunk: %w", jsonErr)
+			}
+
+			// the prompt ratings come once, the candidate ratings with later chunks
+			if chunk.PromptFeedback != nil {
+				promptFeedback = chunk.PromptFeedback
+			}
+			safety := safetyRatings(promptFeedback, chunk.Candidates)
+
+			if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+				return &ContentBlockedError{Reason: chunk.PromptFeedback.BlockReason, Body: line, Safety: safety}
 			}
-			if bytes.HasPrefix(line, []byte("data: ")) {
-				line = line[len("data: "):]
+			if len(safety) > 0 {
+				if evtErr := onEvent(sdk.StreamEvent{Safety: safety}); evtErr != nil {
+					return evtErr
+				}
 			}
-			if bytes.Equal(line, []byte("[DONE]")) {
-				return nil
+			// every chunk carries the counts so far, the last one is complete
+			if chunk.UsageMetadata != nil {
+				usage = chunk.UsageMetadata
 			}
 
-			var chunk GeminiResponseChunk
+			if len(chunk.Candidates) > 0 {
+				candidate := chunk.Candidates[0]
 
-			if jsonErr := json.Unmarshal(line, &chunk); jsonErr == nil {
-				if len(chunk.Candidates) > 0 {
-					candidate := chunk.Candidates[0]
+				if candidate.FinishReason == "SAFETY" || candidate.FinishReason == "RECITATION" {
+					return &ContentBlockedError{Reason: candidate.FinishReason, Body: line, Safety: safety}
+				}
 
-					if candidate.FinishReason == "SAFETY" || candidate.FinishReason == "RECITATION" {
-						return &ContentBlockedError{Reason: candidate.FinishReason, Body: line}
+				for _, part := range candidate.Content.Parts {
+					var evt sdk.StreamEvent
+					if part.Thought {
+						evt.Reasoning = part.Text
+					} else {
+						evt.Content = part.Text
 					}
-
-					if len(candidate.Content.Parts) > 0 {
-						text := candidate.Content.Parts[0].Text
-						if text != "" {
-							if chunkErr := onChunk(text); chunkErr != nil {
-								return chunkErr
-							}
+					if part.ThoughtSignature != "" {
+						evt.Thinking = &sdk.ThinkingBlock{Signature: part.ThoughtSignature}
+					}
+					if part.FunctionCall != nil {
+						call, callErr := part.FunctionCall.toSDK(calls)
+						if callErr != nil {
+							return callErr
 						}
+						calls++
+						evt.ToolCall = &call
 					}
-
-					if candidate.FinishReason == "STOP" || candidate.FinishReason == "MAX_TOKENS" {
-						return nil
+					if evt.Content != "" || evt.Reasoning != "" || evt.Thinking != nil || evt.ToolCall != nil {
+						if evtErr := onEvent(evt); evtErr != nil {
+							return evtErr
+						}
 					}
 				}
-			} else {
-				continue
 			}
 		}
 
 		if err != nil {
-			if err == io.EOF {
-				return nil
+			if err != io.EOF {
+				return err
+			}
+			if usage != nil {
+				return onEvent(sdk.StreamEvent{Usage: usage.toSDK()})
 			}
-			return err
+			return nil
+		}
+	}
+}
+
+// returns the prompt and first candidate safety ratings
+func safetyRatings(feedback *PromptFeedback, candidates []Candidate) []sdk.SafetyRating {
+	var ratings []sdk.SafetyRating
+	if feedback != nil {
+		ratings = append(ratings, feedback.SafetyRatings...)
+	}
+	if len(candidates) > 0 {
+		ratings = append(ratings, candidates[0].SafetyRatings...)
+	}
+	return ratings
+}
+
+// returns the unanswered call with the given id, or the first unanswered call when none matches,
+// such as in histories built by the caller, and marks it answered
+func matchFunctionCall(calls []sdk.ToolCallRequest, answered []bool, id string) sdk.ToolCallRequest {
+	for i, call := range calls {
+		if call.ID == id && !answered[i] {
+			answered[i] = true
+			return call
+		}
+	}
+	for i, call := range calls {
+		if !answered[i] {
+			answered[i] = true
+			return call
 		}
 	}
+	return sdk.ToolCallRequest{}
+}
+
+// prefix of the ids made up for calls gemini sent without one
+const geminiSyntheticIDPrefix = "call_"
+
+// returns id unless it was made up by the sdk, gemini is only sent ids it issued
+func geminiIssuedID(id string) string {
+	if strings.HasPrefix(id, geminiSyntheticIDPrefix) {
+		return ""
+	}
+	return id
+}
+
+// uses the id gemini sent, or call_<n> for the nth call of the response when it sent none
+func (fc *GeminiFunctionCall) toSDK(n int) (sdk.ToolCallRequest, error) {
+	id := fc.ID
+	if id == "" {
+		id = fmt.Sprintf("%s%d", geminiSyntheticIDPrefix, n)
+	}
+	args, err := json.Marshal(fc.Args)
+	if err != nil {
+		return sdk.ToolCallRequest{}, fmt.Errorf("failed to marshal function call args: %w", err)
+	}
+	if fc.Args == nil {
+		args = []byte("{}")
+	}
+	return sdk.ToolCallRequest{ID: id, Name: fc.Name, Arguments: json.RawMessage(args)}, nil
+}
+
+// thought tokens are billed as output, so they count as completion tokens
+func (u *GeminiUsageMetadata) toSDK() *sdk.Usage {
+	if u == nil {
+		return nil
+	}
+	usage := &sdk.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+		CacheReadTokens:  u.CachedContentTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
 }
 
 func convertSDKToolsToProviderTools(sdkTools map[string]sdk.Tool) *GeminiToolConfig {
@@ -388,21 +593,16 @@ func convertSDKToolsToProviderTools(sdkTools map[string]sdk.Tool) *GeminiToolCon
 	declarations := make([]GeminiFunctionDeclaration, 0, len(sdkTools))
 
 	for name, tool := range sdkTools {
-		var required []string
-		properties := make(map[string]GeminiPropertyDef)
-
-		for propName, prop := range tool.InputSchema {
-			// Convert SDK property to Gemini property (without Required field)
-			properties[propName] = GeminiPropertyDef{
-				Type:        prop.Type,
-				Description: prop.Description,
-			}
-
-			if prop.Required {
-				required = append(required, propName)
-			}
+		if len(tool.RawSchema) > 0 {
+			declarations = append(declarations, GeminiFunctionDeclaration{
+				Name:                 name,
+				Description:          tool.Description,
+				ParametersJSONSchema: tool.RawSchema,
+			})
+			continue
 		}
 
+		properties, required := convertGeminiProperties(tool.InputSchema)
 		declarations = append(declarations, GeminiFunctionDeclaration{
 			Name:        name,
 			Description: tool.Description,
@@ -418,3 +618,47 @@ func convertSDKToolsToProviderTools(sdkTools map[string]sdk.Tool) *GeminiToolCon
 		FunctionDeclarations: declarations,
 	}
 }
+
+// maps a tool choice to a gemini function calling config
+func geminiFunctionCallingConfig(choice string) *GeminiFunctionCallingConfig {
+	switch choice {
+	case sdk.ToolChoiceAuto:
+		return &GeminiFunctionCallingConfig{Mode: "AUTO"}
+	case sdk.ToolChoiceNone:
+		return &GeminiFunctionCallingConfig{Mode: "NONE"}
+	case sdk.ToolChoiceRequired:
+		return &GeminiFunctionCallingConfig{Mode: "ANY"}
+	default:
+		return &GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{choice}}
+	}
+}
+
+func convertGeminiProperty(prop sdk.Property) GeminiPropertyDef {
+	def := GeminiPropertyDef{
+		Type:        prop.Type,
+		Description: prop.Description,
+		Enum:        prop.Enum,
+	}
+	if prop.Items != nil {
+		items := convertGeminiProperty(*prop.Items)
+		def.Items = &items
+	}
+	if len(prop.Properties) > 0 {
+		def.Properties, def.Required = convertGeminiProperties(prop.Properties)
+	}
+	return def
+}
+
+// converts the properties of an object, Required moves to the list of required names
+func convertGeminiProperties(schema sdk.InputSchema) (map[string]GeminiPropertyDef, []string) {
+	var required []string
+	properties := make(map[string]GeminiPropertyDef, len(schema))
+	for name, prop := range schema {
+		properties[name] = convertGeminiProperty(prop)
+		if prop.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return properties, required
+}
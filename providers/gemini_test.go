@@ -0,0 +1,133 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func TestGeminiFunctionResponseNames(t *testing.T) {
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, `{"candidates":[{"content":{"parts":[{"text":"done"}]}}]}`))
+
+	messages := []sdk.Message{
+		{Role: "user", Content: "weather and time"},
+		{Role: "assistant", ToolCalls: []sdk.ToolCallRequest{
+			{ID: "call_0", Name: "weather", Arguments: json.RawMessage(`{}`)},
+			{ID: "abc", Name: "time", Arguments: json.RawMessage(`{}`)},
+		}},
+		// answered out of order, the second one by an id the model turn does not know
+		{Role: "tool", ToolCallID: "abc", Content: "noon"},
+		{Role: "tool", ToolCallID: "unknown", Content: "sunny"},
+	}
+	if _, err := NewGeminiProvider("key").CreateCompletion(context.Background(), messages, &sdk.Options{Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var req GeminiRequest
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	calls := req.Contents[1].Parts
+	if calls[0].FunctionCall.ID != "" || calls[1].FunctionCall.ID != "abc" {
+		t.Errorf("function call ids = %q, %q, want only the gemini issued one", calls[0].FunctionCall.ID, calls[1].FunctionCall.ID)
+	}
+
+	responses := req.Contents[2].Parts
+	if len(responses) != 2 {
+		t.Fatalf("got %d function responses in the turn, want 2", len(responses))
+	}
+	if r := responses[0].FunctionResponse; r.Name != "time" || r.ID != "abc" {
+		t.Errorf("first response = %+v", r)
+	}
+	if r := responses[1].FunctionResponse; r.Name != "weather" || r.ID != "" {
+		t.Errorf("second response = %+v, want the unanswered weather call", r)
+	}
+}
+
+func TestGeminiSyntheticIDsMatchBetweenPaths(t *testing.T) {
+	chunk := `{"candidates":[{"content":{"parts":[{"text":"checking"},{"functionCall":{"name":"a","args":{}}},{"functionCall":{"id":"g1","name":"b","args":{}}},{"functionCall":{"name":"c"}}]}}]}`
+	p := NewGeminiProvider("key")
+
+	resp, err := p.ParseCompletion([]byte(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed []string
+	err = p.ParseEvents(strings.NewReader("data: "+chunk+"\n"), func(evt sdk.StreamEvent) error {
+		if evt.ToolCall != nil {
+			streamed = append(streamed, evt.ToolCall.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"call_0", "g1", "call_2"}
+	for i, call := range resp.ToolCalls {
+		if call.ID != want[i] || streamed[i] != want[i] {
+			t.Errorf("call %d: completion id %q, stream id %q, want %q", i, call.ID, streamed[i], want[i])
+		}
+	}
+}
+
+func TestGeminiSafetyRatingsReturnedWithResponse(t *testing.T) {
+	chunk := `{"promptFeedback":{"safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"LOW"}]},"candidates":[{"content":{"parts":[{"text":"hi"}]},"safetyRatings":[{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"NEGLIGIBLE"}]}]}`
+	p := NewGeminiProvider("key")
+
+	resp, err := p.ParseCompletion([]byte(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Safety) != 2 || resp.Safety[0].Probability != "LOW" || resp.Safety[1].Category != "HARM_CATEGORY_DANGEROUS_CONTENT" {
+		t.Errorf("completion safety = %+v", resp.Safety)
+	}
+
+	pipe := sdk.NewEventPipe(nil)
+	go func() { pipe.Finish(p.ParseEvents(strings.NewReader("data: "+chunk+"\n"), pipe.Emit)) }()
+	if _, err := io.ReadAll(pipe); err != nil {
+		t.Fatal(err)
+	}
+	if got := pipe.Result().Safety; len(got) != 2 {
+		t.Errorf("stream safety = %+v", got)
+	}
+}
+
+func TestGeminiBlockedPromptCarriesSafetyRatings(t *testing.T) {
+	body := `{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true}]}}`
+
+	_, err := NewGeminiProvider("key").ParseCompletion([]byte(body))
+	var blocked *sdk.ContentBlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want a ContentBlockedError", err)
+	}
+	if len(blocked.Safety) != 1 || !blocked.Safety[0].Blocked {
+		t.Errorf("blocked safety = %+v", blocked.Safety)
+	}
+}
+
+func TestGeminiToolChoice(t *testing.T) {
+	no := false
+	for choice, want := range map[string]string{
+		"":         "null",
+		"none":     `{"functionCallingConfig":{"mode":"NONE"}}`,
+		"required": `{"functionCallingConfig":{"mode":"ANY"}}`,
+		"weather":  `{"functionCallingConfig":{"allowedFunctionNames":["weather"],"mode":"ANY"}}`,
+	} {
+		// gemini has no switch for parallel calls, so it is left out of the request
+		body := toolChoiceBody(t, NewGeminiProvider("key"), `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`, choice, &no)
+		if got := jsonOf(body["toolConfig"]); got != want {
+			t.Errorf("%q: toolConfig = %s, want %s", choice, got, want)
+		}
+		if tools := jsonOf(body["tools"]); !strings.Contains(tools, "weather") || !strings.Contains(tools, `"time"`) {
+			t.Errorf("%q: tools = %s, want both tools", choice, tools)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Ollama provider
+
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type OllamaProvider struct {
+	*base.Provider
+	BaseURL   string                 // defaults to http://localhost:11434
+	APIKey    string                 // optional, sent as a bearer token for servers behind an auth proxy
+	KeepAlive string                 // how long the model stays loaded after a request, e.g. "10m" or "-1"
+	Format    json.RawMessage        // "json" or a JSON schema the response must follow
+	Options   map[string]interface{} // model options such as num_ctx, top_k or seed
+}
+
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	p := &OllamaProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+	}
+	p.Provider = &base.Provider{APICaller: p, Name: "ollama"}
+	return p
+}
+
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type OllamaToolCall struct {
+	Function OllamaFunctionCall `json:"function"`
+}
+
+type OllamaFunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// a response, or one line of a streamed response
+type OllamaResponse struct {
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+func (p *OllamaProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
+	url := p.BaseURL + "/api/chat"
+
+	body := map[string]interface{}{
+		"messages": convertOllamaMessages(messages),
+		"stream":   streamMode,
+	}
+
+	// request settings override the ones on the provider
+	options := map[string]interface{}{}
+	for k, v := range p.Options {
+		options[k] = v
+	}
+	format := p.Format
+	keepAlive := p.KeepAlive
+
+	if opts != nil {
+		for k, v := range opts.ModelOptions {
+			options[k] = v
+		}
+		if len(opts.ResponseFormat) > 0 {
+			format = opts.ResponseFormat
+		}
+		if opts.KeepAlive != "" {
+			keepAlive = opts.KeepAlive
+		}
+		if opts.Model != "" {
+			body["model"] = opts.Model
+		}
+		if opts.Temperature != 0 {
+			options["temperature"] = opts.Temperature
+		}
+		if opts.MaxCompletionTokens != 0 {
+			options["num_predict"] = opts.MaxCompletionTokens
+		}
+		if r := opts.ReasoningConfig(); r != nil {
+			body["think"] = true
+		}
+		if len(opts.Tools) > 0 && opts.ToolChoice != sdk.ToolChoiceNone {
+			body["tools"] = base.OpenAiTools(opts.Tools)
+		}
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	if len(format) > 0 {
+		body["format"] = format
+	}
+	if keepAlive != "" {
+		body["keep_alive"] = keepAlive
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if key := p.ResolveAPIKey(ctx, p.APIKey); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (p *OllamaProvider) ParseCompletion(body []byte) (*sdk.CompletionResponse, error) {
+	var response OllamaResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse ollama response: %w. Body: %s", err, string(body))
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("ollama error: %s", response.Error)
+	}
+
+	compResp := &sdk.CompletionResponse{
+		Role:      "assistant",
+		Content:   response.Message.Content,
+		Reasoning: response.Message.Thinking,
+		Usage:     response.usage(),
+	}
+	for i, tc := range response.Message.ToolCalls {
+		compResp.ToolCalls = append(compResp.ToolCalls, tc.toSDK(i))
+	}
+	return compResp, nil
+}
+
+// reads the newline delimited JSON stream, usage arrives on the final line
+func (p *OllamaProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
+	reader := bufio.NewReader(body)
+	toolCalls := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var chunk OllamaResponse
+			if jsonErr := json.Unmarshal(line, &chunk); jsonErr != nil {
+				return fmt.Errorf("failed to parse ollama stream line: %w", jsonErr)
+			}
+			if chunk.Error != "" {
+				return fmt.Errorf("ollama error: %s", chunk.Error)
+			}
+
+			if chunk.Message.Content != "" || chunk.Message.Thinking != "" {
+				if evtErr := onEvent(sdk.StreamEvent{Content: chunk.Message.Content, Reasoning: chunk.Message.Thinking}); evtErr != nil {
+					return evtErr
+				}
+			}
+			for _, tc := range chunk.Message.ToolCalls {
+				call := tc.toSDK(toolCalls)
+				toolCalls++
+				if evtErr := onEvent(sdk.StreamEvent{ToolCall: &call}); evtErr != nil {
+					return evtErr
+				}
+			}
+
+			if chunk.Done {
+				return onEvent(sdk.StreamEvent{Usage: chunk.usage()})
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (r *OllamaResponse) usage() *sdk.Usage {
+	if r.PromptEvalCount == 0 && r.EvalCount == 0 {
+		return nil
+	}
+	return &sdk.Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// ollama does not return tool call IDs, so they are numbered by position
+func (tc OllamaToolCall) toSDK(i int) sdk.ToolCallRequest {
+	args := tc.Function.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	return sdk.ToolCallRequest{
+		ID:        fmt.Sprintf("call_%d", i),
+		Name:      tc.Function.Name,
+		Arguments: args,
+	}
+}
+
+// converts sdk messages, tool results are matched to their tool name through the earlier tool calls
+func convertOllamaMessages(messages []sdk.Message) []OllamaMessage {
+	toolNames := map[string]string{}
+	out := make([]OllamaMessage, 0, len(messages))
+
+	for _, m := range messages {
+		msg := OllamaMessage{
+			Role:    m.Role,
+			Content: m.Content,
+			Images:  m.Images,
+		}
+		for _, tc := range m.ToolCalls {
+			toolNames[tc.ID] = tc.Name
+			args := tc.Arguments
+			if len(args) == 0 {
+				args = json.RawMessage("{}")
+			}
+			msg.ToolCalls = append(msg.ToolCalls, OllamaToolCall{
+				Function: OllamaFunctionCall{Name: tc.Name, Arguments: args},
+			})
+		}
+		if m.Role == "tool" {
+			msg.ToolName = toolNames[m.ToolCallID]
+		}
+		out = append(out, msg)
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+func TestOllamaStreamToolCallsAndUsage(t *testing.T) {
+	rec := &recorder{}
+	server := rec.server(t, `{"message":{"role":"assistant","content":"","thinking":"need the weather"},"done":false}
+{"message":{"role":"assistant","content":"Checking"},"done":false}
+
+{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"weather","arguments":{"city":"Oslo"}}},{"function":{"name":"time"}}]},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":5}
+`)
+
+	p := NewOllamaProvider(server.URL + "/")
+	p.KeepAlive = "5m"
+	p.Options = map[string]interface{}{"num_ctx": 4096, "seed": 1}
+
+	stream, err := p.CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "weather?"}}, &sdk.Options{
+		Model:          "llama3",
+		Temperature:    0.5,
+		ResponseFormat: json.RawMessage(`"json"`),
+		KeepAlive:      "-1",
+		ModelOptions:   map[string]any{"seed": 7},
+		Tools:          map[string]sdk.Tool{"weather": {Description: "weather"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Checking" {
+		t.Errorf("content = %q", content)
+	}
+
+	result := stream.(sdk.StreamResult).Result()
+	if result.Reasoning != "need the weather" {
+		t.Errorf("reasoning = %q", result.Reasoning)
+	}
+	if len(result.ToolCalls) != 2 {
+		t.Fatalf("tool calls = %+v", result.ToolCalls)
+	}
+	if c := result.ToolCalls[0]; c.ID != "call_0" || c.Name != "weather" || string(c.Arguments) != `{"city":"Oslo"}` {
+		t.Errorf("first call = %+v", c)
+	}
+	if c := result.ToolCalls[1]; c.ID != "call_1" || string(c.Arguments) != `{}` {
+		t.Errorf("second call = %+v", c)
+	}
+	if u := result.Usage; u == nil || u.PromptTokens != 12 || u.CompletionTokens != 5 || u.TotalTokens != 17 {
+		t.Errorf("usage = %+v", u)
+	}
+
+	var body struct {
+		Model     string          `json:"model"`
+		Stream    bool            `json:"stream"`
+		Format    json.RawMessage `json:"format"`
+		KeepAlive string          `json:"keep_alive"`
+		Options   map[string]any  `json:"options"`
+		Tools     []any           `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.urls[0] != "/api/chat" || body.Model != "llama3" || !body.Stream || len(body.Tools) != 1 {
+		t.Errorf("request %s = %s", rec.urls[0], rec.bodies[0])
+	}
+	// request settings win over the provider ones, which fill the rest
+	if string(body.Format) != `"json"` || body.KeepAlive != "-1" {
+		t.Errorf("format %s keep_alive %q, want the request values", body.Format, body.KeepAlive)
+	}
+	if body.Options["seed"] != 7.0 || body.Options["num_ctx"] != 4096.0 || body.Options["temperature"] != 0.5 {
+		t.Errorf("options = %v", body.Options)
+	}
+}
+
+func TestOllamaStreamError(t *testing.T) {
+	server := (&recorder{}).server(t, `{"message":{"role":"assistant","content":"par"},"done":false}
+{"error":"model ran out of memory"}
+`)
+
+	stream, err := NewOllamaProvider(server.URL).CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "llama3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(stream)
+	if err == nil || err.Error() != "ollama error: model ran out of memory" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestOllamaToolChoice(t *testing.T) {
+	no := false
+	// ollama only knows whether tools are offered, so none drops them and every other choice offers all
+	for choice, want := range map[string]int{"": 2, "auto": 2, "required": 2, "weather": 2, "none": 0} {
+		body := toolChoiceBody(t, NewOllamaProvider(""), `{"message":{"role":"assistant","content":"ok"},"done":true}`, choice, &no)
+		tools, _ := body["tools"].([]any)
+		if len(tools) != want {
+			t.Errorf("%q: %d tools, want %d", choice, len(tools), want)
+		}
+		for _, unsupported := range []string{"tool_choice", "parallel_tool_calls"} {
+			if _, ok := body[unsupported]; ok {
+				t.Errorf("%q: %s was sent", choice, unsupported)
+			}
+		}
+	}
+}
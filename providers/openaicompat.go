@@ -0,0 +1,128 @@
+// generic provider for APIs compatible with the OpenAI chat completions format
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+type OpenAICompatibleConfig struct {
+	Name       string // provider name, used for rate limit keys
+	BaseURL    string // e.g. "http://localhost:8000/v1", "/chat/completions" is appended
+	AuthHeader string // header carrying the API key, defaults to "Authorization" with the "Bearer" scheme
+	AuthScheme string // prefix of the key in AuthHeader, only used when AuthHeader is set
+	TokenField string // "max_tokens" or "max_completion_tokens", defaults to "max_tokens"
+
+	Headers   map[string]string      // extra headers sent with every request
+	ExtraBody map[string]interface{} // extra fields merged into every request body
+
+	// maps the reasoning configuration onto the body, reasoning is not sent when nil
+	Reasoning func(body map[string]interface{}, r *sdk.Reasoning)
+
+	// quirks
+	NoTools       bool // the API rejects tools, they are never sent
+	NoTemperature bool // the API rejects temperature, it is never sent
+}
+
+type OpenAICompatibleProvider struct {
+	*base.Provider
+	Config OpenAICompatibleConfig
+	APIKey string // may be empty for local servers without auth
+}
+
+func NewOpenAICompatibleProvider(config OpenAICompatibleConfig, apiKey string) *OpenAICompatibleProvider {
+	if config.Name == "" {
+		config.Name = "openai-compatible"
+	}
+	p := &OpenAICompatibleProvider{
+		Config: config,
+		APIKey: apiKey,
+	}
+	p.Provider = &base.Provider{APICaller: p, Name: config.Name}
+	return p
+}
+
+// builds the chat completions request body
+func (p *OpenAICompatibleProvider) requestBody(messages []sdk.Message, streamMode bool, opts *sdk.Options) map[string]interface{} {
+	body := map[string]interface{}{}
+	for k, v := range p.Config.ExtraBody {
+		body[k] = v
+	}
+	body["messages"] = base.OpenAiMessages(messages)
+	body["stream"] = streamMode
+
+	if opts != nil {
+		if opts.Model != "" {
+			body["model"] = opts.Model
+		}
+		if opts.MaxCompletionTokens != 0 {
+			field := p.Config.TokenField
+			if field == "" {
+				field = "max_tokens"
+			}
+			body[field] = opts.MaxCompletionTokens
+		}
+		if r := opts.ReasoningConfig(); r != nil && p.Config.Reasoning != nil {
+			p.Config.Reasoning(body, r)
+		}
+		if opts.Temperature != 0 && !p.Config.NoTemperature {
+			body["temperature"] = opts.Temperature
+		}
+	}
+	if !p.Config.NoTools {
+		base.ApplyOpenAiTools(body, opts)
+	}
+	return body
+}
+
+func (p *OpenAICompatibleProvider) CallAPI(ctx context.Context, messages []sdk.Message, streamMode bool, opts *sdk.Options) (io.ReadCloser, error) {
+	url := strings.TrimRight(p.Config.BaseURL, "/") + "/chat/completions"
+
+	jsonBody, err := json.Marshal(p.requestBody(messages, streamMode, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if key := p.ResolveAPIKey(ctx, p.APIKey); key != "" {
+		if p.Config.AuthHeader == "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		} else if p.Config.AuthScheme != "" {
+			req.Header.Set(p.Config.AuthHeader, p.Config.AuthScheme+" "+key)
+		} else {
+			req.Header.Set(p.Config.AuthHeader, key)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.Config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (p *OpenAICompatibleProvider) ParseEvents(body io.Reader, onEvent func(sdk.StreamEvent) error) error {
+	return base.ParseJsonEvents(body, onEvent)
+}
+
+// streams only the content text, kept for callers of the StreamParser interface
+func (p *OpenAICompatibleProvider) ParseResponse(body io.Reader, onChunk func(string) error) error {
+	return base.ParseJsonStream(body, onChunk)
+}
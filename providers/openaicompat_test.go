@@ -0,0 +1,212 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+// replies to each request with the next body and records the request bodies
+type sequenceServer struct {
+	replies []string
+	bodies  []string
+}
+
+func (s *sequenceServer) start(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		s.bodies = append(s.bodies, string(body))
+		if len(s.bodies) > len(s.replies) {
+			t.Errorf("unexpected request %d: %s", len(s.bodies), body)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, s.replies[len(s.bodies)-1])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIStreamToolCallsRunInToolLoop(t *testing.T) {
+	seq := &sequenceServer{replies: []string{
+		`data: {"choices":[{"delta":{"role":"assistant","content":"Checking. "}}]}
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"weather","arguments":""}}]}}]}
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}
+data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"time","arguments":"{}"}}]}}]}
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Oslo\"}"}}]}}]}
+data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}
+data: [DONE]
+`,
+		`data: {"choices":[{"delta":{"content":"Sunny at noon."}}]}
+data: {"choices":[{"delta":{},"finish_reason":"stop"}]}
+data: [DONE]
+`,
+	}}
+	redirectTo(t, seq.start(t))
+
+	var ran []string
+	tool := func(name string) sdk.Tool {
+		return sdk.Tool{Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			ran = append(ran, name+string(args))
+			return "ok", nil
+		}}
+	}
+
+	resp := sdk.NewSDK(NewOpenAiProvider("key")).ChatCompletion(context.Background(), &sdk.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []sdk.Message{{Role: "user", Content: "weather and time in Oslo?"}},
+		Stream:   true,
+		Tools:    map[string]sdk.Tool{"weather": tool("weather"), "time": tool("time")},
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	content, err := io.ReadAll(resp.Stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "Checking. Sunny at noon." {
+		t.Errorf("content = %q", content)
+	}
+	if len(ran) != 2 || ran[0] != `weather{"city":"Oslo"}` || ran[1] != "time{}" {
+		t.Errorf("tools ran %v", ran)
+	}
+	if len(seq.bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(seq.bodies))
+	}
+
+	var second struct {
+		Messages []struct {
+			Role       string `json:"role"`
+			ToolCallID string `json:"tool_call_id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(seq.bodies[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	last := second.Messages[len(second.Messages)-1]
+	if last.Role != "tool" || last.ToolCallID != "call_b" {
+		t.Errorf("second request ends with %+v, want the time result", last)
+	}
+}
+
+func TestOpenAIToolChoice(t *testing.T) {
+	no := false
+	for _, tc := range []struct {
+		choice             string
+		parallel           *bool
+		wantChoice, wantPT string
+	}{
+		{"", nil, "null", "null"},
+		{"auto", nil, `"auto"`, "null"},
+		{"required", &no, `"required"`, "false"},
+		{"weather", &no, `{"function":{"name":"weather"},"type":"function"}`, "false"},
+	} {
+		body := toolChoiceBody(t, NewOpenAiProvider("key"), `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`, tc.choice, tc.parallel)
+		if jsonOf(body["tool_choice"]) != tc.wantChoice || jsonOf(body["parallel_tool_calls"]) != tc.wantPT {
+			t.Errorf("%q: tool_choice %s parallel_tool_calls %s, want %s %s",
+				tc.choice, jsonOf(body["tool_choice"]), jsonOf(body["parallel_tool_calls"]), tc.wantChoice, tc.wantPT)
+		}
+	}
+}
+
+func TestOpenAIIgnoresCacheControl(t *testing.T) {
+	// the OpenAI format caches prompt prefixes on its own, breakpoints would be rejected as unknown fields
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	_, err := NewOpenAiProvider("key").CreateCompletion(context.Background(), []sdk.Message{
+		{Role: "system", Content: "rules", CacheControl: true},
+		{Role: "user", Content: "hi", CacheControl: true},
+	}, &sdk.Options{
+		Model:             "gpt-4o",
+		CacheSystemPrompt: true,
+		Tools:             map[string]sdk.Tool{"weather": {Description: "weather", CacheControl: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(rec.bodies[0], "cache_control") || rec.headers[0].Get("anthropic-beta") != "" {
+		t.Errorf("request carries cache breakpoints: %s", rec.bodies[0])
+	}
+}
+
+func TestOpenAICompatibleReasoningRequest(t *testing.T) {
+	reply := `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`
+	for _, tc := range []struct {
+		name      string
+		provider  sdk.Provider
+		reasoning *sdk.Reasoning
+		want      map[string]string // fields and their JSON, "null" for fields that must be missing
+	}{
+		{"openai", NewOpenAiProvider("k"), &sdk.Reasoning{BudgetTokens: 10000},
+			map[string]string{"reasoning_effort": `"high"`, "reasoning": "null"}},
+		{"xai", NewXaiProvider("k"), &sdk.Reasoning{Effort: "low"},
+			map[string]string{"reasoning_effort": `"low"`}},
+		{"groq", NewGroqCloudProvider("k"), &sdk.Reasoning{Effort: "medium"},
+			map[string]string{"reasoning_effort": `"medium"`, "reasoning_format": `"parsed"`}},
+		{"groq excluded", NewGroqCloudProvider("k"), &sdk.Reasoning{Effort: "medium", Exclude: true},
+			map[string]string{"reasoning_format": `"hidden"`}},
+		{"openrouter budget", NewOpenRouterProvider("k"), &sdk.Reasoning{Effort: "low", BudgetTokens: 3000, Exclude: true},
+			map[string]string{"reasoning": `{"exclude":true,"max_tokens":3000}`, "reasoning_effort": "null"}},
+		{"openrouter effort", NewOpenRouterProvider("k"), &sdk.Reasoning{Effort: "high"},
+			map[string]string{"reasoning": `{"effort":"high"}`}},
+		{"mistral", NewMistralProvider("k"), &sdk.Reasoning{Effort: "high"},
+			map[string]string{"reasoning": "null", "reasoning_effort": "null"}},
+	} {
+		rec := &recorder{}
+		redirectTo(t, rec.server(t, reply))
+		if _, err := tc.provider.CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{Model: "m", Reasoning: tc.reasoning}); err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]any
+		json.Unmarshal([]byte(rec.bodies[0]), &body)
+		for field, want := range tc.want {
+			if got := jsonOf(body[field]); got != want {
+				t.Errorf("%s: %s = %s, want %s", tc.name, field, got, want)
+			}
+		}
+	}
+}
+
+func TestOpenAIReasoningKeptApartFromContent(t *testing.T) {
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, `{"choices":[{"message":{"role":"assistant","content":"42","reasoning_content":"6 times 7"}}]}`))
+	resp, err := NewOpenAiProvider("k").CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "?"}}, &sdk.Options{Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "42" || resp.Reasoning != "6 times 7" {
+		t.Errorf("content %q reasoning %q", resp.Content, resp.Reasoning)
+	}
+
+	// deepseek style reasoning_content and openrouter style reasoning deltas
+	redirectTo(t, rec.server(t, `data: {"choices":[{"delta":{"role":"assistant","reasoning_content":"6 times "}}]}
+data: {"choices":[{"delta":{"reasoning":"7"}}]}
+data: {"choices":[{"delta":{"content":"42"}}]}
+data: {"choices":[{"delta":{},"finish_reason":"stop"}]}
+data: [DONE]
+`))
+	var streamed []string
+	stream, err := NewOpenAiProvider("k").CreateCompletionStream(context.Background(), []sdk.Message{{Role: "user", Content: "?"}}, &sdk.Options{
+		Model:       "m",
+		OnReasoning: func(s string) { streamed = append(streamed, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := stream.(sdk.StreamResult).Result()
+	if string(content) != "42" || result.Reasoning != "6 times 7" || strings.Join(streamed, "|") != "6 times |7" {
+		t.Errorf("content %q reasoning %q streamed %q", content, result.Reasoning, streamed)
+	}
+}
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+// sends every request made through http.DefaultClient to server, keeping path and query
+func redirectTo(t *testing.T, server *httptest.Server) {
+	t.Helper()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	t.Cleanup(func() { http.DefaultClient.Transport = previous })
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// records the body, URL and headers of every request and replies with reply
+type recorder struct {
+	bodies  []string
+	urls    []string
+	headers []http.Header
+}
+
+func (r *recorder) server(t *testing.T, reply string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.bodies = append(r.bodies, string(body))
+		r.urls = append(r.urls, req.URL.String())
+		r.headers = append(r.headers, req.Header)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sends one request with two tools, choice and parallel through p and returns the decoded request body
+func toolChoiceBody(t *testing.T, p sdk.Provider, reply, choice string, parallel *bool) map[string]any {
+	t.Helper()
+	rec := &recorder{}
+	redirectTo(t, rec.server(t, reply))
+	_, err := p.CreateCompletion(context.Background(), []sdk.Message{{Role: "user", Content: "hi"}}, &sdk.Options{
+		Model:             "m",
+		Tools:             map[string]sdk.Tool{"weather": {Description: "weather"}, "time": {Description: "time"}},
+		ToolChoice:        choice,
+		ParallelToolCalls: parallel,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// the JSON encoding of v, for comparing decoded request fields
+func jsonOf(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,227 @@
+// Vertex AI backend for the Gemini provider and Google service account tokens
+
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unsafe0x0/ai/v2/base"
+	"github.com/unsafe0x0/ai/v2/sdk"
+)
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+type GeminiVertexConfig struct {
+	Project     string
+	Location    string          // e.g. "us-central1", or "global"
+	Publisher   string          // model publisher, defaults to "google"
+	TokenSource sdk.TokenSource // OAuth access tokens, e.g. a GoogleServiceAccount
+	Endpoint    string          // overrides https://{location}-aiplatform.googleapis.com, e.g. for private endpoints
+}
+
+// creates a Gemini provider that talks to Vertex AI instead of the Gemini API
+func NewGeminiVertexProvider(project, location string, tokens sdk.TokenSource) *GeminiProvider {
+	p := &GeminiProvider{
+		Vertex: &GeminiVertexConfig{Project: project, Location: location, TokenSource: tokens},
+	}
+	p.Provider = &base.Provider{APICaller: p, Name: "vertex"}
+	return p
+}
+
+// returns the generateContent or streamGenerateContent URL of a publisher model
+func (v *GeminiVertexConfig) url(model string, streamMode bool) string {
+	endpoint := "https://" + v.Location + "-aiplatform.googleapis.com"
+	if v.Location == "global" {
+		endpoint = "https://aiplatform.googleapis.com"
+	}
+	if v.Endpoint != "" {
+		endpoint = strings.TrimRight(v.Endpoint, "/")
+	}
+	publisher := v.Publisher
+	if publisher == "" {
+		publisher = "google"
+	}
+
+	u := fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/%s/models/%s",
+		endpoint, url.PathEscape(v.Project), url.PathEscape(v.Location), url.PathEscape(publisher), url.PathEscape(model))
+	if streamMode {
+		return u + ":streamGenerateContent?alt=sse"
+	}
+	return u + ":generateContent"
+}
+
+func (v *GeminiVertexConfig) authorize(ctx context.Context, req *http.Request) error {
+	if v.TokenSource == nil {
+		return fmt.Errorf("vertex ai requires a token source")
+	}
+	token, err := v.TokenSource.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get google access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// a token source that signs JWTs with a service account key and exchanges them for access tokens
+type GoogleServiceAccount struct {
+	ClientEmail  string
+	PrivateKeyID string
+	TokenURI     string
+	Scopes       []string // defaults to cloud-platform
+
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// parses a service account JSON key as downloaded from the Google Cloud console
+func NewGoogleServiceAccount(jsonKey []byte) (*GoogleServiceAccount, error) {
+	var file struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(jsonKey, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	if file.Type != "service_account" {
+		return nil, fmt.Errorf("key type is %q, expected service_account", file.Type)
+	}
+
+	block, _ := pem.Decode([]byte(file.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not an RSA key")
+	}
+
+	if file.TokenURI == "" {
+		file.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &GoogleServiceAccount{
+		ClientEmail:  file.ClientEmail,
+		PrivateKeyID: file.PrivateKeyID,
+		TokenURI:     file.TokenURI,
+		key:          key,
+	}, nil
+}
+
+// reads a service account key file, e.g. the one named by GOOGLE_APPLICATION_CREDENTIALS
+func NewGoogleServiceAccountFromFile(path string) (*GoogleServiceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGoogleServiceAccount(data)
+}
+
+// returns a cached access token, fetching a new one shortly before it expires
+func (s *GoogleServiceAccount) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expires) > time.Minute {
+		return s.token, nil
+	}
+
+	assertion, err := s.signJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &sdk.APIError{StatusCode: resp.StatusCode, Message: string(body), Body: body}
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	s.token = token.AccessToken
+	s.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// builds an RS256 signed JWT asserting the service account identity
+func (s *GoogleServiceAccount) signJWT(now time.Time) (string, error) {
+	scopes := s.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{cloudPlatformScope}
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.ClientEmail,
+		"scope": strings.Join(scopes, " "),
+		"aud":   s.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
@@ -0,0 +1,511 @@
+// agents running the tool loop with stop conditions and step hooks
+
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Agent struct {
+	Name         string
+	Description  string // tells other agents when to hand off to this one
+	Instructions string // system prompt
+	Model        string
+	Provider     Provider
+	Tools        map[string]Tool
+
+	Handoffs    []*Agent // agents this one can transfer the conversation to
+	MaxHandoffs int      // max transfers in one run, defaults to 10
+
+	StopWhen []StopCondition // checked after every step with tool calls, defaults to MaxSteps(5)
+
+	MaxTokens         int
+	Temperature       float32
+	Documents         []Document
+	Reasoning         *Reasoning
+	ToolChoice        string // forced choices apply to the first step only
+	ParallelToolCalls *bool
+	ToolConcurrency   int
+	ToolTimeout       time.Duration
+	CacheSystemPrompt bool
+
+	OnStepStart  func(step int, messages []Message) // called before each model call with the conversation so far
+	OnStepFinish func(step *AgentStep)              // called after each step once its tools have run
+	OnToolCall   func(toolName string, args json.RawMessage)
+	OnApproval   ApprovalFunc
+	OnHandoff    func(from, to *Agent) // called when the conversation is transferred to another agent
+}
+
+// one model call of an agent run and the tool results it produced
+type AgentStep struct {
+	Agent       string // name of the agent that made the step
+	Number      int    // counted from 0 per agent, continues across resumed runs
+	Response    *CompletionResponse
+	ToolResults []Message // tool messages sent back to the model, empty when the model answered
+}
+
+type FinishReason string
+
+const (
+	FinishStop      FinishReason = "stop"      // the model answered without calling tools
+	FinishCondition FinishReason = "condition" // a stop condition ended the run
+	FinishPaused    FinishReason = "paused"    // a tool call is waiting for approval
+)
+
+type AgentResult struct {
+	Content      string // content of the last step
+	Reasoning    string // reasoning of all steps
+	Steps        []AgentStep
+	ToolCalls    []ToolCallRequest // every tool call of the run in order
+	Messages     []Message         // the conversation including the tool calls and results of the run
+	Transcript   []TranscriptEntry // the messages produced by the run and the agent behind each
+	Usage        *Usage            // aggregated over all steps
+	Agent        string            // name of the agent that finished the run
+	FinishReason FinishReason
+	Paused       *LoopState // set when FinishReason is FinishPaused, pass it to Resume to continue
+}
+
+type TranscriptEntry struct {
+	Agent   string
+	Message Message
+}
+
+// creates an agent using the SDK provider, with the SDK budget and cache applied
+func (sdk *SDK) NewAgent(name, instructions, model string, tools map[string]Tool) *Agent {
+	return &Agent{
+		Name:         name,
+		Instructions: instructions,
+		Model:        model,
+		Provider:     sdk.forRequest(&CompletionRequest{}).provider,
+		Tools:        tools,
+	}
+}
+
+// decides after a step whether the run should stop, steps holds the steps of the run so far
+type StopCondition func(steps []AgentStep) bool
+
+// stops once n steps have been made
+func MaxSteps(n int) StopCondition {
+	return func(steps []AgentStep) bool {
+		return len(steps) > 0 && steps[len(steps)-1].Number+1 >= n
+	}
+}
+
+// stops once the model has called the named tool, e.g. "final_answer"
+func ToolCalled(name string) StopCondition {
+	return func(steps []AgentStep) bool {
+		if len(steps) == 0 {
+			return false
+		}
+		for _, tc := range steps[len(steps)-1].Response.ToolCalls {
+			if tc.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// runs the agent on a conversation, the instructions are used as the system prompt
+func (a *Agent) Run(ctx context.Context, messages []Message) (*AgentResult, error) {
+	return a.run(ctx, messages, nil)
+}
+
+// runs the agent on a single user prompt
+func (a *Agent) Prompt(ctx context.Context, prompt string) (*AgentResult, error) {
+	return a.run(ctx, []Message{{Role: "user", Content: prompt}}, nil)
+}
+
+// continues a run that was paused for approval
+func (a *Agent) Resume(ctx context.Context, state *LoopState) (*AgentResult, error) {
+	return a.run(ctx, nil, state)
+}
+
+// runs the agent and follows handoffs until an agent finishes
+func (a *Agent) run(ctx context.Context, messages []Message, resume *LoopState) (*AgentResult, error) {
+	current := a
+	if resume != nil && resume.Agent != "" {
+		if found := a.find(resume.Agent, map[*Agent]bool{}); found != nil {
+			current = found
+		}
+	}
+
+	maxHandoffs := a.MaxHandoffs
+	if maxHandoffs == 0 {
+		maxHandoffs = 10
+	}
+
+	total := &AgentResult{Usage: &Usage{}}
+	var reasoning []string
+
+	for handoffs := 0; ; handoffs++ {
+		before := len(messages)
+		if resume != nil {
+			before = len(resume.Messages)
+		}
+
+		if current.Provider == nil {
+			return total, fmt.Errorf("agent %q has no provider", current.Name)
+		}
+
+		result, err := current.runSteps(ctx, messages, resume)
+
+		total.Content = result.Content
+		total.Steps = append(total.Steps, result.Steps...)
+		total.ToolCalls = append(total.ToolCalls, result.ToolCalls...)
+		total.Messages = result.Messages
+		total.Usage.Add(result.Usage)
+		total.Agent = current.Name
+		total.FinishReason = result.FinishReason
+		total.Paused = result.Paused
+		if result.Reasoning != "" {
+			reasoning = append(reasoning, result.Reasoning)
+		}
+		total.Reasoning = strings.Join(reasoning, "\n\n")
+		if before <= len(result.Messages) {
+			for _, m := range result.Messages[before:] {
+				total.Transcript = append(total.Transcript, TranscriptEntry{Agent: current.Name, Message: m})
+			}
+		}
+
+		if err != nil {
+			return total, err
+		}
+
+		next := current.handoffTarget(result)
+		if next == nil {
+			return total, nil
+		}
+		if handoffs >= maxHandoffs {
+			return total, fmt.Errorf("reached maximum handoffs (%d)", maxHandoffs)
+		}
+
+		// calls to tools the next agent does not have, such as the transfer itself, are rejected by
+		// several providers, so they are kept as plain text
+		messages = toolCallsAsText(result.Messages, next.toolNames())
+		resume = nil
+		// thinking signatures are only valid for the provider that produced them
+		if next.Provider != current.Provider {
+			messages = withoutThinking(messages)
+		}
+
+		if current.OnHandoff != nil {
+			current.OnHandoff(current, next)
+		}
+		current = next
+	}
+}
+
+// runs the tool loop of this agent alone, stopping when it hands off
+func (a *Agent) runSteps(ctx context.Context, messages []Message, resume *LoopState) (*AgentResult, error) {
+	tools := a.Tools
+	stop := a.StopWhen
+	if len(stop) == 0 {
+		stop = []StopCondition{MaxSteps(5)}
+	}
+
+	if len(a.Handoffs) > 0 {
+		tools = make(map[string]Tool, len(a.Tools)+len(a.Handoffs))
+		for name, tool := range a.Tools {
+			tools[name] = tool
+		}
+		for _, target := range a.Handoffs {
+			tools[handoffToolName(target)] = handoffTool(target)
+		}
+		stop = append([]StopCondition{a.handedOff}, stop...)
+	}
+
+	opts := &Options{
+		Model:               a.Model,
+		SystemPrompt:        a.Instructions,
+		MaxCompletionTokens: a.MaxTokens,
+		Temperature:         a.Temperature,
+		Documents:           a.Documents,
+		Reasoning:           a.Reasoning,
+		Tools:               tools,
+		ToolChoice:          a.ToolChoice,
+		ParallelToolCalls:   a.ParallelToolCalls,
+		ToolConcurrency:     a.ToolConcurrency,
+		ToolTimeout:         a.ToolTimeout,
+		CacheSystemPrompt:   a.CacheSystemPrompt,
+	}
+
+	runner := &toolRunner{
+		tools:       tools,
+		onToolCall:  a.OnToolCall,
+		onApproval:  a.OnApproval,
+		concurrency: a.ToolConcurrency,
+		timeout:     a.ToolTimeout,
+	}
+
+	loop := &toolLoop{
+		agent:        a.Name,
+		provider:     a.Provider,
+		runner:       runner,
+		stopWhen:     stop,
+		onStepStart:  a.OnStepStart,
+		onStepFinish: a.OnStepFinish,
+	}
+	return loop.run(ctx, messages, opts, resume)
+}
+
+// name of the tool that transfers the conversation to target
+func handoffToolName(target *Agent) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, target.Name)
+	return "transfer_to_" + name
+}
+
+func handoffTool(target *Agent) Tool {
+	description := fmt.Sprintf("Transfer the conversation to the %s agent.", target.Name)
+	if target.Description != "" {
+		description += " " + target.Description
+	}
+	return Tool{
+		Description: description,
+		InputSchema: InputSchema{},
+		Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			return fmt.Sprintf("Transferred to %s", target.Name), nil
+		},
+	}
+}
+
+// stop condition matching a step that called a handoff tool
+func (a *Agent) handedOff(steps []AgentStep) bool {
+	return len(steps) > 0 && a.handoffFor(steps[len(steps)-1].Response.ToolCalls) != nil
+}
+
+// returns the agent of the first handoff tool call, nil if there is none
+func (a *Agent) handoffFor(calls []ToolCallRequest) *Agent {
+	for _, tc := range calls {
+		for _, target := range a.Handoffs {
+			if tc.Name == handoffToolName(target) {
+				return target
+			}
+		}
+	}
+	return nil
+}
+
+// returns the agent a finished run handed off to, nil if it did not
+func (a *Agent) handoffTarget(result *AgentResult) *Agent {
+	if result.FinishReason != FinishCondition || len(result.Steps) == 0 {
+		return nil
+	}
+	return a.handoffFor(result.Steps[len(result.Steps)-1].Response.ToolCalls)
+}
+
+// finds the named agent among this agent and everything reachable through handoffs
+func (a *Agent) find(name string, seen map[*Agent]bool) *Agent {
+	if seen[a] {
+		return nil
+	}
+	seen[a] = true
+	if a.Name == name {
+		return a
+	}
+	for _, target := range a.Handoffs {
+		if found := target.find(name, seen); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// names of the tools the agent is given, including its handoff tools
+func (a *Agent) toolNames() map[string]bool {
+	names := make(map[string]bool, len(a.Tools)+len(a.Handoffs))
+	for name := range a.Tools {
+		names[name] = true
+	}
+	for _, target := range a.Handoffs {
+		names[handoffToolName(target)] = true
+	}
+	return names
+}
+
+// rewrites calls to tools not in keep, and their results, as text on the assistant message that made them
+func toolCallsAsText(messages []Message, keep map[string]bool) []Message {
+	out := make([]Message, 0, len(messages))
+	rewritten := map[string]int{} // tool call id to the index of its assistant message in out
+
+	for _, m := range messages {
+		if m.Role == "tool" {
+			if i, ok := rewritten[m.ToolCallID]; ok {
+				out[i].Content += "\n" + m.Content
+				continue
+			}
+			out = append(out, m)
+			continue
+		}
+
+		if len(m.ToolCalls) == 0 {
+			out = append(out, m)
+			continue
+		}
+
+		var kept []ToolCallRequest
+		var text []string
+		for _, tc := range m.ToolCalls {
+			if keep[tc.Name] {
+				kept = append(kept, tc)
+				continue
+			}
+			args := string(tc.Arguments)
+			if args == "" {
+				args = "{}"
+			}
+			text = append(text, fmt.Sprintf("Called %s with %s.", tc.Name, args))
+			rewritten[tc.ID] = len(out)
+		}
+		if len(text) > 0 {
+			if m.Content != "" {
+				text = append([]string{m.Content}, text...)
+			}
+			m.Content = strings.Join(text, "\n")
+			m.ToolCalls = kept
+			// the signed thinking led to tool calls that are gone
+			m.Thinking = nil
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func withoutThinking(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, m := range messages {
+		m.Thinking = nil
+		out[i] = m
+	}
+	return out
+}
+
+// the non streaming tool loop shared by agents and ChatCompletion
+type toolLoop struct {
+	agent        string // name recorded on steps and paused states
+	provider     Provider
+	runner       *toolRunner
+	stopWhen     []StopCondition
+	onStepStart  func(step int, messages []Message)
+	onStepFinish func(step *AgentStep)
+}
+
+func (l *toolLoop) run(ctx context.Context, initialMessages []Message, opts *Options, resume *LoopState) (*AgentResult, error) {
+	messages := append([]Message{}, initialMessages...)
+	result := &AgentResult{Usage: &Usage{}}
+	var reasoning []string
+
+	finish := func(reason FinishReason) *AgentResult {
+		result.FinishReason = reason
+		result.Messages = messages
+		result.Reasoning = strings.Join(reasoning, "\n\n")
+		return result
+	}
+
+	pause := func(state *LoopState) (*AgentResult, error) {
+		result.Paused = state
+		return finish(FinishPaused), &ToolLoopPausedError{State: state}
+	}
+
+	start := 0
+	if resume != nil {
+		var state *LoopState
+		messages, state = resumeToolLoop(ctx, l.runner, resume)
+		if state != nil {
+			state.Agent = l.agent
+			messages = state.Messages
+			return pause(state)
+		}
+		start = resume.Step + 1
+		opts = opts.afterFirstStep()
+
+		// the resumed step counts for the stop conditions before the model is asked again
+		assistant := resume.Messages[len(resume.Messages)-1]
+		results := messages[len(resume.Messages):]
+		result.ToolCalls = append(result.ToolCalls, resume.Pending...)
+		result.Steps = append(result.Steps, AgentStep{
+			Agent:       l.agent,
+			Number:      resume.Step,
+			Response:    &CompletionResponse{Role: "assistant", Content: assistant.Content, ToolCalls: resume.Pending, Thinking: assistant.Thinking},
+			ToolResults: results,
+		})
+		if l.onStepFinish != nil {
+			l.onStepFinish(&result.Steps[len(result.Steps)-1])
+		}
+		if l.stopped(result.Steps) {
+			return finish(FinishCondition), nil
+		}
+	}
+
+	for step := start; ; step++ {
+		if l.onStepStart != nil {
+			l.onStepStart(step, messages)
+		}
+
+		compResp, err := l.provider.CreateCompletion(ctx, messages, opts)
+		if err != nil {
+			return finish(""), err
+		}
+		result.Usage.Add(compResp.Usage)
+		result.Content = compResp.Content
+		if compResp.Reasoning != "" {
+			reasoning = append(reasoning, compResp.Reasoning)
+		}
+
+		result.Steps = append(result.Steps, AgentStep{Agent: l.agent, Number: step, Response: compResp})
+		current := &result.Steps[len(result.Steps)-1]
+
+		if len(compResp.ToolCalls) == 0 {
+			messages = append(messages, Message{Role: "assistant", Content: compResp.Content, Thinking: compResp.Thinking})
+			if l.onStepFinish != nil {
+				l.onStepFinish(current)
+			}
+			return finish(FinishStop), nil
+		}
+
+		result.ToolCalls = append(result.ToolCalls, compResp.ToolCalls...)
+		messages = append(messages, Message{
+			Role:      "assistant",
+			Content:   compResp.Content,
+			ToolCalls: compResp.ToolCalls,
+			Thinking:  compResp.Thinking,
+		})
+
+		decisions := map[string]ApprovalDecision{}
+		results, paused := l.runner.run(ctx, compResp.ToolCalls, decisions)
+		if paused {
+			return pause(&LoopState{Agent: l.agent, Messages: messages, Pending: compResp.ToolCalls, Decisions: decisions, Step: step})
+		}
+		messages = append(messages, results...)
+		current.ToolResults = results
+
+		if l.onStepFinish != nil {
+			l.onStepFinish(current)
+		}
+
+		if l.stopped(result.Steps) {
+			return finish(FinishCondition), nil
+		}
+		opts = opts.afterFirstStep()
+	}
+}
+
+// reports whether any stop condition matches the steps so far
+func (l *toolLoop) stopped(steps []AgentStep) bool {
+	for _, cond := range l.stopWhen {
+		if cond(steps) {
+			return true
+		}
+	}
+	return false
+}
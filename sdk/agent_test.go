@@ -0,0 +1,83 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// replies with the scripted responses in order and records every request
+type scriptedProvider struct {
+	replies  []*CompletionResponse
+	requests [][]Message
+	tools    []map[string]Tool
+}
+
+func (p *scriptedProvider) CreateCompletion(ctx context.Context, messages []Message, opts *Options) (*CompletionResponse, error) {
+	p.requests = append(p.requests, messages)
+	p.tools = append(p.tools, opts.Tools)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply, nil
+}
+
+func (p *scriptedProvider) CreateCompletionStream(ctx context.Context, messages []Message, opts *Options) (io.ReadCloser, error) {
+	return nil, io.EOF
+}
+
+func TestHandoffKeepsOnlyKnownToolCalls(t *testing.T) {
+	lookup := Tool{
+		Description: "looks up an account",
+		Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			return "account 42", nil
+		},
+	}
+
+	triageProvider := &scriptedProvider{replies: []*CompletionResponse{
+		{ToolCalls: []ToolCallRequest{{ID: "c1", Name: "lookup", Arguments: json.RawMessage(`{}`)}}},
+		{ToolCalls: []ToolCallRequest{{ID: "c2", Name: "transfer_to_billing", Arguments: json.RawMessage(`{}`)}}},
+	}}
+	billingProvider := &scriptedProvider{replies: []*CompletionResponse{{Content: "refunded"}}}
+
+	billing := &Agent{Name: "billing", Provider: billingProvider}
+	triage := &Agent{
+		Name:     "triage",
+		Provider: triageProvider,
+		Tools:    map[string]Tool{"lookup": lookup},
+		Handoffs: []*Agent{billing},
+	}
+
+	result, err := triage.Prompt(context.Background(), "refund me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Agent != "billing" || result.Content != "refunded" {
+		t.Fatalf("got agent %q content %q", result.Agent, result.Content)
+	}
+
+	history := billingProvider.requests[0]
+	for _, m := range history {
+		if m.Role == "tool" || len(m.ToolCalls) > 0 {
+			t.Fatalf("billing has no tools but received a tool message: %+v", m)
+		}
+	}
+	var text []string
+	for _, m := range history {
+		text = append(text, m.Content)
+	}
+	joined := strings.Join(text, "\n")
+	for _, want := range []string{"Called lookup", "account 42", "Called transfer_to_billing", "Transferred to billing"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("history is missing %q:\n%s", want, joined)
+		}
+	}
+}
+
+func TestAgentWithoutProvider(t *testing.T) {
+	agent := &Agent{Name: "lonely"}
+	if _, err := agent.Prompt(context.Background(), "hi"); err == nil {
+		t.Fatal("expected an error for an agent without a provider")
+	}
+}
@@ -0,0 +1,52 @@
+// human in the loop approval of tool calls and pausing / resuming the tool loop
+
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type ApprovalAction string
+
+const (
+	Approve ApprovalAction = "approve" // run the tool, with Arguments replacing the model's arguments when set
+	Deny    ApprovalAction = "deny"    // skip the tool and send Reason back to the model
+	Pause   ApprovalAction = "pause"   // stop the loop so it can be resumed later from its LoopState
+)
+
+type ApprovalDecision struct {
+	Action    ApprovalAction  `json:"action"`
+	Reason    string          `json:"reason,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// decides whether a tool call that requires approval may run
+type ApprovalFunc func(ctx context.Context, call ToolCallRequest) ApprovalDecision
+
+// serializable state of a paused tool loop
+type LoopState struct {
+	Messages  []Message                   `json:"messages"`            // conversation up to and including the assistant tool call message
+	Pending   []ToolCallRequest           `json:"pending"`             // tool calls of the paused step
+	Decisions map[string]ApprovalDecision `json:"decisions,omitempty"` // decisions by tool call ID, filled in before resuming
+	Step      int                         `json:"step"`
+	Agent     string                      `json:"agent,omitempty"` // agent that paused, for agent runs with handoffs
+}
+
+// records a decision for a pending tool call so it is not asked for again on resume
+func (s *LoopState) Decide(toolCallID string, decision ApprovalDecision) {
+	if s.Decisions == nil {
+		s.Decisions = make(map[string]ApprovalDecision)
+	}
+	s.Decisions[toolCallID] = decision
+}
+
+// returned when a tool loop is paused waiting for approval
+type ToolLoopPausedError struct {
+	State *LoopState
+}
+
+func (e *ToolLoopPausedError) Error() string {
+	return fmt.Sprintf("tool loop paused at step %d with %d pending tool calls", e.State.Step, len(e.State.Pending))
+}
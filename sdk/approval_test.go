@@ -0,0 +1,283 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// a tool that requires approval and records the arguments it ran with
+func approvalTool(ran *[]string) Tool {
+	return Tool{
+		RequiresApproval: true,
+		Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			*ran = append(*ran, string(args))
+			return "done", nil
+		},
+	}
+}
+
+func threeCalls() *CompletionResponse {
+	return &CompletionResponse{ToolCalls: []ToolCallRequest{
+		{ID: "a", Name: "act", Arguments: json.RawMessage(`{"n":1}`)},
+		{ID: "b", Name: "act", Arguments: json.RawMessage(`{"n":2}`)},
+		{ID: "c", Name: "act", Arguments: json.RawMessage(`{"n":3}`)},
+	}}
+}
+
+// the tool messages at the end of a request, by tool call ID
+func toolResults(messages []Message) map[string]string {
+	out := map[string]string{}
+	for _, m := range messages {
+		if m.Role == "tool" {
+			out[m.ToolCallID] = m.Content
+		}
+	}
+	return out
+}
+
+func TestApprovalDecisions(t *testing.T) {
+	var ran []string
+	provider := &scriptedProvider{replies: []*CompletionResponse{threeCalls(), {Content: "finished"}}}
+
+	resp := NewSDK(provider).ChatCompletion(context.Background(), &CompletionRequest{
+		Messages: []Message{{Role: "user", Content: "go"}},
+		Tools:    map[string]Tool{"act": approvalTool(&ran)},
+		OnApproval: func(ctx context.Context, call ToolCallRequest) ApprovalDecision {
+			switch call.ID {
+			case "a":
+				return ApprovalDecision{Action: Approve}
+			case "b":
+				return ApprovalDecision{Action: Approve, Arguments: json.RawMessage(`{"n":20}`)}
+			default:
+				return ApprovalDecision{Action: Deny, Reason: "too many"}
+			}
+		},
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if resp.Content != "finished" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if strings.Join(ran, " ") != `{"n":1} {"n":20}` {
+		t.Errorf("tool ran with %v, want the approved and the edited arguments", ran)
+	}
+
+	results := toolResults(provider.requests[1])
+	if results["a"] != `"done"` || results["b"] != `"done"` {
+		t.Errorf("results = %v", results)
+	}
+	if !strings.Contains(results["c"], "denied by user: too many") {
+		t.Errorf("denied result = %q", results["c"])
+	}
+}
+
+func TestApprovalWithoutApproverDenies(t *testing.T) {
+	var ran []string
+	provider := &scriptedProvider{replies: []*CompletionResponse{threeCalls(), {Content: "finished"}}}
+
+	resp := NewSDK(provider).ChatCompletion(context.Background(), &CompletionRequest{
+		Messages: []Message{{Role: "user", Content: "go"}},
+		Tools:    map[string]Tool{"act": approvalTool(&ran)},
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if len(ran) != 0 {
+		t.Errorf("tool ran with %v", ran)
+	}
+	if r := toolResults(provider.requests[1])["a"]; !strings.Contains(r, "no approver is configured") {
+		t.Errorf("result = %q", r)
+	}
+}
+
+// pauses on the first call and returns the state after a JSON round trip, as a caller storing it would
+func pauseOnFirstCall(t *testing.T, resp *Response, err error) *LoopState {
+	t.Helper()
+	var paused *ToolLoopPausedError
+	if !errors.As(err, &paused) {
+		t.Fatalf("err = %v, want a ToolLoopPausedError", err)
+	}
+	if resp != nil && resp.Paused != paused.State {
+		t.Errorf("Response.Paused is not the state of the error")
+	}
+
+	b, err := json.Marshal(paused.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state LoopState
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Pending) != 3 || state.Pending[1].ID != "b" || len(state.Messages) != 2 || state.Messages[1].Role != "assistant" {
+		t.Fatalf("state after round trip = %+v", state)
+	}
+	return &state
+}
+
+func pauseFirst(decide ApprovalAction) ApprovalFunc {
+	return func(ctx context.Context, call ToolCallRequest) ApprovalDecision {
+		if call.ID == "a" {
+			return ApprovalDecision{Action: Pause}
+		}
+		return ApprovalDecision{Action: decide}
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	var ran []string
+	tools := map[string]Tool{"act": approvalTool(&ran)}
+	provider := &scriptedProvider{replies: []*CompletionResponse{threeCalls(), {Content: "finished"}}}
+	client := NewSDK(provider)
+
+	resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+		Messages:   []Message{{Role: "user", Content: "go"}},
+		Tools:      tools,
+		OnApproval: pauseFirst(Approve),
+	})
+	state := pauseOnFirstCall(t, resp, resp.Error)
+	if len(ran) != 0 {
+		t.Fatalf("tools ran before the pause was resolved: %v", ran)
+	}
+
+	state.Decide("a", ApprovalDecision{Action: Deny, Reason: "not now"})
+	resp = client.ChatCompletion(context.Background(), &CompletionRequest{
+		Tools:      tools,
+		Resume:     state,
+		OnApproval: pauseFirst(Approve),
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if resp.Content != "finished" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if strings.Join(ran, " ") != `{"n":2} {"n":3}` {
+		t.Errorf("tool ran with %v", ran)
+	}
+	if r := toolResults(provider.requests[1]); !strings.Contains(r["a"], "not now") || r["c"] != `"done"` {
+		t.Errorf("results after resume = %v", r)
+	}
+}
+
+func TestResumeAtLastStepStopsWithoutAnotherCall(t *testing.T) {
+	var ran []string
+	tools := map[string]Tool{"act": approvalTool(&ran)}
+	provider := &scriptedProvider{replies: []*CompletionResponse{threeCalls(), {Content: "unused"}}}
+	client := NewSDK(provider)
+
+	resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+		Messages:     []Message{{Role: "user", Content: "go"}},
+		Tools:        tools,
+		MaxToolSteps: 1,
+		OnApproval:   pauseFirst(Approve),
+	})
+	state := pauseOnFirstCall(t, resp, resp.Error)
+	state.Decide("a", ApprovalDecision{Action: Approve})
+
+	resp = client.ChatCompletion(context.Background(), &CompletionRequest{
+		Tools:        tools,
+		Resume:       state,
+		MaxToolSteps: 1,
+		OnApproval:   pauseFirst(Approve),
+	})
+	var maxSteps *MaxToolStepsError
+	if !errors.As(resp.Error, &maxSteps) {
+		t.Errorf("err = %v, want a MaxToolStepsError", resp.Error)
+	}
+	if len(provider.requests) != 1 {
+		t.Errorf("model called %d times, want only the call before the pause", len(provider.requests))
+	}
+	if len(ran) != 3 {
+		t.Errorf("tool ran %d times, want 3", len(ran))
+	}
+}
+
+func TestStreamingPauseAndResume(t *testing.T) {
+	var ran []string
+	tools := map[string]Tool{"act": approvalTool(&ran)}
+	calls := threeCalls().ToolCalls
+	provider := &steppedProvider{steps: [][]StreamEvent{
+		{{ToolCall: &calls[0]}, {ToolCall: &calls[1]}, {ToolCall: &calls[2]}},
+		{{Content: "finished"}},
+	}}
+	client := NewSDK(provider)
+
+	resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+		Messages:   []Message{{Role: "user", Content: "go"}},
+		Tools:      tools,
+		Stream:     true,
+		OnApproval: pauseFirst(Deny),
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	_, err := io.ReadAll(resp.Stream)
+	state := pauseOnFirstCall(t, nil, err)
+
+	state.Decide("a", ApprovalDecision{Action: Approve, Arguments: json.RawMessage(`{"n":10}`)})
+	resp = client.ChatCompletion(context.Background(), &CompletionRequest{
+		Tools:      tools,
+		Stream:     true,
+		Resume:     state,
+		OnApproval: pauseFirst(Deny),
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	content, err := io.ReadAll(resp.Stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "finished" {
+		t.Errorf("content = %q", content)
+	}
+	if strings.Join(ran, " ") != `{"n":10}` {
+		t.Errorf("tool ran with %v, want only the edited approved call", ran)
+	}
+	if r := toolResults(provider.requests[1]); !strings.Contains(r["b"], "denied") || r["a"] != `"done"` {
+		t.Errorf("results after resume = %v", r)
+	}
+}
+
+func TestStreamingResumeAtLastStepStopsWithoutAnotherCall(t *testing.T) {
+	var ran []string
+	tools := map[string]Tool{"act": approvalTool(&ran)}
+	calls := threeCalls().ToolCalls
+	provider := &steppedProvider{steps: [][]StreamEvent{
+		{{ToolCall: &calls[0]}, {ToolCall: &calls[1]}, {ToolCall: &calls[2]}},
+	}}
+	client := NewSDK(provider)
+
+	resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+		Messages:     []Message{{Role: "user", Content: "go"}},
+		Tools:        tools,
+		Stream:       true,
+		MaxToolSteps: 1,
+		OnApproval:   pauseFirst(Approve),
+	})
+	_, err := io.ReadAll(resp.Stream)
+	state := pauseOnFirstCall(t, nil, err)
+	state.Decide("a", ApprovalDecision{Action: Approve})
+
+	resp = client.ChatCompletion(context.Background(), &CompletionRequest{
+		Tools:        tools,
+		Stream:       true,
+		Resume:       state,
+		MaxToolSteps: 1,
+		OnApproval:   pauseFirst(Approve),
+	})
+	_, err = io.ReadAll(resp.Stream)
+	var maxSteps *MaxToolStepsError
+	if !errors.As(err, &maxSteps) {
+		t.Errorf("err = %v, want a MaxToolStepsError", err)
+	}
+	if len(provider.requests) != 1 || len(ran) != 3 {
+		t.Errorf("model called %d times and tool %d times, want 1 and 3", len(provider.requests), len(ran))
+	}
+}
@@ -0,0 +1,278 @@
+// token, cost and request budgets enforced across completions
+
+package sdk
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type Budget struct {
+	MaxTokens   int                     // max total tokens, 0 means unlimited
+	MaxCost     float64                 // max estimated cost in USD, 0 means unlimited
+	MaxRequests int                     // max requests per window, 0 means unlimited
+	Window      time.Duration           // window for MaxRequests, 0 means the lifetime of the budget
+	Pricing     map[string]ModelPricing // per model pricing used for cost estimates
+
+	mu       sync.Mutex
+	tokens   int
+	cost     float64
+	requests []time.Time
+}
+
+// prices in USD per million tokens
+type ModelPricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// remaining budget, -1 means unlimited
+type BudgetRemaining struct {
+	Tokens   int
+	Cost     float64
+	Requests int
+}
+
+// returns what is left of the budget
+func (b *Budget) Remaining() BudgetRemaining {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rem := BudgetRemaining{Tokens: -1, Cost: -1, Requests: -1}
+	if b.MaxTokens > 0 {
+		rem.Tokens = max(b.MaxTokens-b.tokens, 0)
+	}
+	if b.MaxCost > 0 {
+		rem.Cost = max(b.MaxCost-b.cost, 0)
+	}
+	if b.MaxRequests > 0 {
+		rem.Requests = max(b.MaxRequests-len(b.activeRequests(time.Now())), 0)
+	}
+	return rem
+}
+
+// clears all recorded usage
+func (b *Budget) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = 0
+	b.cost = 0
+	b.requests = nil
+}
+
+// returns the requests made inside the current window, must hold mu
+func (b *Budget) activeRequests(now time.Time) []time.Time {
+	if b.Window <= 0 {
+		return b.requests
+	}
+	i := 0
+	for i < len(b.requests) && now.Sub(b.requests[i]) >= b.Window {
+		i++
+	}
+	b.requests = b.requests[i:]
+	return b.requests
+}
+
+// checks the limits, must hold mu
+func (b *Budget) check() error {
+	if b.MaxTokens > 0 && b.tokens >= b.MaxTokens {
+		return &BudgetExceededError{Limit: "tokens", Used: float64(b.tokens), Max: float64(b.MaxTokens)}
+	}
+	if b.MaxCost > 0 && b.cost >= b.MaxCost {
+		return &BudgetExceededError{Limit: "cost", Used: b.cost, Max: b.MaxCost}
+	}
+	return nil
+}
+
+// checks the budget and records a new request made at now
+func (b *Budget) reserve(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	if b.MaxRequests > 0 {
+		active := b.activeRequests(now)
+		if len(active) >= b.MaxRequests {
+			return &BudgetExceededError{Limit: "requests", Used: float64(len(active)), Max: float64(b.MaxRequests)}
+		}
+	}
+	b.requests = append(b.requests, now)
+	return nil
+}
+
+// forgets a request recorded by reserve that was never sent
+func (b *Budget) release(at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := len(b.requests) - 1; i >= 0; i-- {
+		if b.requests[i].Equal(at) {
+			b.requests = append(b.requests[:i], b.requests[i+1:]...)
+			return
+		}
+	}
+}
+
+// records token usage and returns an error if the budget is now exhausted
+func (b *Budget) record(model string, promptTokens, completionTokens int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += promptTokens + completionTokens
+	if price, ok := b.Pricing[model]; ok {
+		b.cost += float64(promptTokens)*price.InputPerMillion/1e6 +
+			float64(completionTokens)*price.OutputPerMillion/1e6
+	}
+	return b.check()
+}
+
+// rough token estimate for text, about 4 characters per token
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
+
+// rough token estimate for a conversation
+func EstimateMessageTokens(messages []Message) int {
+	total := 0
+	for _, m := range messages {
+		total += EstimateTokens(m.Content) + 4
+		for _, tc := range m.ToolCalls {
+			total += EstimateTokens(tc.Name) + EstimateTokens(string(tc.Arguments))
+		}
+	}
+	return total
+}
+
+// wraps a provider and enforces budgets on every call
+type budgetProvider struct {
+	Provider
+	budgets []*Budget
+}
+
+// reserves a request in every budget, or in none when any of them is exhausted
+func (p *budgetProvider) reserve() error {
+	now := time.Now()
+	for i, b := range p.budgets {
+		if err := b.reserve(now); err != nil {
+			for _, reserved := range p.budgets[:i] {
+				reserved.release(now)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *budgetProvider) record(model string, promptTokens, completionTokens int) error {
+	var exceeded error
+	for _, b := range p.budgets {
+		if err := b.record(model, promptTokens, completionTokens); err != nil && exceeded == nil {
+			exceeded = err
+		}
+	}
+	return exceeded
+}
+
+func (p *budgetProvider) CreateCompletion(ctx context.Context, messages []Message, opts *Options) (*CompletionResponse, error) {
+	if err := p.reserve(); err != nil {
+		return nil, err
+	}
+
+	compResp, err := p.Provider.CreateCompletion(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if compResp.Usage == nil {
+		prompt := EstimateMessageTokens(messages)
+		completion := EstimateTokens(compResp.Content)
+		compResp.Usage = &Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		}
+	}
+
+	// the response is already paid for, so it is returned and the next call fails
+	p.record(opts.Model, compResp.Usage.PromptTokens, compResp.Usage.CompletionTokens)
+	return compResp, nil
+}
+
+func (p *budgetProvider) CreateCompletionStream(ctx context.Context, messages []Message, opts *Options) (io.ReadCloser, error) {
+	if err := p.reserve(); err != nil {
+		return nil, err
+	}
+
+	stream, err := p.Provider.CreateCompletionStream(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := EstimateMessageTokens(messages)
+	if err := p.record(opts.Model, prompt, 0); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return &budgetStream{ReadCloser: stream, provider: p, model: opts.Model, prompt: prompt}, nil
+}
+
+// counts streamed output against the budgets and stops once they run out,
+// the estimates are replaced by the reported usage when the stream ends, fails or is closed
+type budgetStream struct {
+	io.ReadCloser
+	provider   *budgetProvider
+	model      string
+	prompt     int // estimated prompt tokens charged up front
+	bytes      int
+	tokens     int // estimated completion tokens charged so far
+	reconciled bool
+}
+
+func (s *budgetStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if n > 0 {
+		s.bytes += n
+		tokens := (s.bytes + 3) / 4
+		delta := tokens - s.tokens
+		s.tokens = tokens
+		if budgetErr := s.provider.record(s.model, 0, delta); budgetErr != nil && err == nil {
+			err = budgetErr
+		}
+	}
+	if err != nil {
+		s.reconcile()
+	}
+	return n, err
+}
+
+func (s *budgetStream) Close() error {
+	s.reconcile()
+	return s.ReadCloser.Close()
+}
+
+// charges the difference between the reported usage and the estimates
+func (s *budgetStream) reconcile() {
+	if s.reconciled {
+		return
+	}
+	s.reconciled = true
+
+	result := s.Result()
+	if result == nil || result.Usage == nil {
+		return
+	}
+	s.provider.record(s.model, result.Usage.PromptTokens-s.prompt, result.Usage.CompletionTokens-s.tokens)
+}
+
+func (s *budgetStream) Result() *CompletionResponse {
+	return streamResultOf(s.ReadCloser)
+}
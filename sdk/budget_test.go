@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// streams the given events through an EventPipe
+type streamingProvider struct {
+	scriptedProvider
+	events []StreamEvent
+}
+
+func (p *streamingProvider) CreateCompletionStream(ctx context.Context, messages []Message, opts *Options) (io.ReadCloser, error) {
+	pipe := NewEventPipe(nil)
+	go func() {
+		for _, evt := range p.events {
+			if err := pipe.Emit(evt); err != nil {
+				pipe.Finish(err)
+				return
+			}
+		}
+		pipe.Finish(nil)
+	}()
+	return pipe, nil
+}
+
+func TestRejectedRequestIsNotRecordedInOtherBudgets(t *testing.T) {
+	shared := &Budget{MaxRequests: 5}
+	perRequest := &Budget{MaxTokens: 10}
+	perRequest.record("", 10, 0)
+
+	p := &budgetProvider{
+		Provider: &scriptedProvider{replies: []*CompletionResponse{{Content: "unused"}}},
+		budgets:  []*Budget{shared, perRequest},
+	}
+
+	_, err := p.CreateCompletion(context.Background(), nil, &Options{})
+	var exceeded *BudgetExceededError
+	if !errors.As(err, &exceeded) || exceeded.Limit != "tokens" {
+		t.Fatalf("err = %v, want a tokens BudgetExceededError", err)
+	}
+	if rem := shared.Remaining().Requests; rem != 5 {
+		t.Errorf("shared budget has %d requests left, want 5", rem)
+	}
+}
+
+func TestStreamBudgetUsesReportedUsage(t *testing.T) {
+	budget := &Budget{}
+	p := &budgetProvider{
+		Provider: &streamingProvider{events: []StreamEvent{
+			{Content: "a fairly long streamed answer that estimates to many tokens"},
+			{Usage: &Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10}},
+		}},
+		budgets: []*Budget{budget},
+	}
+
+	stream, err := p.CreateCompletionStream(context.Background(), []Message{{Role: "user", Content: "hello there"}}, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(stream); err != nil {
+		t.Fatal(err)
+	}
+
+	if budget.tokens != 10 {
+		t.Errorf("budget charged %d tokens, want the reported 10", budget.tokens)
+	}
+}
+
+func TestClosedStreamBudgetUsesReportedUsage(t *testing.T) {
+	budget := &Budget{}
+	p := &budgetProvider{
+		// the usage arrives before the content, as with providers that report it up front
+		Provider: &streamingProvider{events: []StreamEvent{
+			{Usage: &Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10}},
+			{Content: "a fairly long streamed answer that the caller stops reading early"},
+		}},
+		budgets: []*Budget{budget},
+	}
+
+	stream, err := p.CreateCompletionStream(context.Background(), []Message{{Role: "user", Content: "a prompt long enough to estimate"}}, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	if budget.tokens != 10 {
+		t.Errorf("budget charged %d tokens, want the reported 10", budget.tokens)
+	}
+}
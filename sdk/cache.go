@@ -0,0 +1,306 @@
+// response caching keyed on a canonical hash of the request
+
+package sdk
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Cache interface {
+	Get(key string) (*CompletionResponse, bool)
+	Set(key string, resp *CompletionResponse, ttl time.Duration)
+}
+
+// returns a canonical hash of the messages and the options that affect the response
+func CacheKey(messages []Message, opts *Options) string {
+	type toolSchema struct {
+		Description string          `json:"description,omitempty"`
+		InputSchema InputSchema     `json:"input_schema,omitempty"`
+		RawSchema   json.RawMessage `json:"raw_schema,omitempty"`
+	}
+
+	key := struct {
+		Messages        []Message             `json:"messages"`
+		Model           string                `json:"model,omitempty"`
+		SystemPrompt    string                `json:"system_prompt,omitempty"`
+		MaxTokens       int                   `json:"max_tokens,omitempty"`
+		Temperature     float32               `json:"temperature,omitempty"`
+		TopP            float32               `json:"top_p,omitempty"`
+		TopK            int                   `json:"top_k,omitempty"`
+		StopSequences   []string              `json:"stop_sequences,omitempty"`
+		Documents       []Document            `json:"documents,omitempty"`
+		ResponseFormat  json.RawMessage       `json:"response_format,omitempty"`
+		ModelOptions    map[string]any        `json:"model_options,omitempty"`
+		ReasoningEffort string                `json:"reasoning_effort,omitempty"`
+		Reasoning       *Reasoning            `json:"reasoning,omitempty"`
+		Tools           map[string]toolSchema `json:"tools,omitempty"`
+		CacheSystem     bool                  `json:"cache_system,omitempty"`
+		ToolChoice      string                `json:"tool_choice,omitempty"`
+		ParallelTools   *bool                 `json:"parallel_tool_calls,omitempty"`
+	}{
+		Messages: messages,
+	}
+
+	if opts != nil {
+		key.Model = opts.Model
+		key.SystemPrompt = opts.SystemPrompt
+		key.MaxTokens = opts.MaxCompletionTokens
+		key.Temperature = opts.Temperature
+		key.TopP = opts.TopP
+		key.TopK = opts.TopK
+		key.StopSequences = opts.StopSequences
+		key.Documents = opts.Documents
+		key.ResponseFormat = opts.ResponseFormat
+		key.ModelOptions = opts.ModelOptions
+		key.ReasoningEffort = opts.ReasoningEffort
+		key.Reasoning = opts.Reasoning
+		key.CacheSystem = opts.CacheSystemPrompt
+		key.ToolChoice = opts.ToolChoice
+		key.ParallelTools = opts.ParallelToolCalls
+		if len(opts.Tools) > 0 {
+			key.Tools = make(map[string]toolSchema, len(opts.Tools))
+			for name, tool := range opts.Tools {
+				key.Tools[name] = toolSchema{Description: tool.Description, InputSchema: tool.InputSchema, RawSchema: tool.RawSchema}
+			}
+		}
+	}
+
+	// maps are marshalled with sorted keys, so equal requests give equal bytes
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// in memory LRU cache
+type MemoryCache struct {
+	Capacity int // max number of entries, 0 means unlimited
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	resp    *CompletionResponse
+	expires time.Time
+}
+
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{Capacity: capacity}
+}
+
+func (c *MemoryCache) Get(key string) (*CompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.resp, true
+}
+
+func (c *MemoryCache) Set(key string, resp *CompletionResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items == nil {
+		c.items = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		el.Value = &memoryEntry{key: key, resp: resp, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&memoryEntry{key: key, resp: resp, expires: expires})
+
+	for c.Capacity > 0 && c.order.Len() > c.Capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// on disk cache storing one JSON file per entry
+type DiskCache struct {
+	Dir string
+}
+
+type diskEntry struct {
+	Response *CompletionResponse `json:"response"`
+	Expires  time.Time           `json:"expires,omitempty"`
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (*CompletionResponse, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Response == nil {
+		return nil, false
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+func (c *DiskCache) Set(key string, resp *CompletionResponse, ttl time.Duration) {
+	entry := diskEntry{Response: resp}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	// write to a temp file first so readers never see a partial entry
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// wraps a provider and serves repeated requests from the cache
+type cachingProvider struct {
+	Provider
+	cache Cache
+	ttl   time.Duration
+}
+
+func (p *cachingProvider) CreateCompletion(ctx context.Context, messages []Message, opts *Options) (*CompletionResponse, error) {
+	key := CacheKey(messages, opts)
+	if cached, ok := p.cache.Get(key); ok {
+		return cloneResponse(cached), nil
+	}
+
+	compResp, err := p.Provider.CreateCompletion(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.Set(key, cloneResponse(compResp), p.ttl)
+	return compResp, nil
+}
+
+func (p *cachingProvider) CreateCompletionStream(ctx context.Context, messages []Message, opts *Options) (io.ReadCloser, error) {
+	key := CacheKey(messages, opts)
+	if cached, ok := p.cache.Get(key); ok && len(cached.ToolCalls) == 0 {
+		return &replayStream{Reader: strings.NewReader(cached.Content), result: cloneResponse(cached)}, nil
+	}
+
+	stream, err := p.Provider.CreateCompletionStream(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingStream{ReadCloser: stream, provider: p, key: key}, nil
+}
+
+// records streamed content and caches it once the stream completes
+type cachingStream struct {
+	io.ReadCloser
+	provider *cachingProvider
+	key      string
+	content  strings.Builder
+	done     bool
+}
+
+func (s *cachingStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.content.Write(p[:n])
+	if errors.Is(err, io.EOF) && !s.done {
+		s.done = true
+		resp := &CompletionResponse{Role: "assistant"}
+		if result := streamResultOf(s.ReadCloser); result != nil {
+			resp = result
+		}
+		resp.Content = s.content.String()
+		s.provider.cache.Set(s.key, resp, s.provider.ttl)
+	}
+	return n, err
+}
+
+func (s *cachingStream) Result() *CompletionResponse {
+	return streamResultOf(s.ReadCloser)
+}
+
+// copies a response so callers and the cache never share its slices or usage
+func cloneResponse(r *CompletionResponse) *CompletionResponse {
+	c := *r
+	c.ToolCalls = append([]ToolCallRequest(nil), r.ToolCalls...)
+	c.Thinking = append([]ThinkingBlock(nil), r.Thinking...)
+	c.Citations = append([]Citation(nil), r.Citations...)
+	c.Safety = append([]SafetyRating(nil), r.Safety...)
+	if r.Usage != nil {
+		usage := *r.Usage
+		c.Usage = &usage
+	}
+	return &c
+}
+
+// replays a cached response as a stream
+type replayStream struct {
+	*strings.Reader
+	result *CompletionResponse
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
+
+func (s *replayStream) Result() *CompletionResponse {
+	return s.result
+}
@@ -0,0 +1,195 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", &CompletionResponse{Content: "a"}, 0)
+	c.Set("b", &CompletionResponse{Content: "b"}, 0)
+	c.Get("a")
+	c.Set("c", &CompletionResponse{Content: "c"}, 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is still cached, want it evicted as the least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if resp, ok := c.Get(key); !ok || resp.Content != key {
+			t.Errorf("Get(%q) = %+v, %v", key, resp, ok)
+		}
+	}
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	c := NewMemoryCache(0)
+	c.Set("short", &CompletionResponse{Content: "x"}, time.Millisecond)
+	c.Set("forever", &CompletionResponse{Content: "y"}, 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Error("expired entry was returned")
+	}
+	if _, ok := c.Get("forever"); !ok {
+		t.Error("entry without ttl was dropped")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(filepath.Join(dir, "nested"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("k", &CompletionResponse{Content: "hello", Usage: &Usage{TotalTokens: 3}}, 0)
+	resp, ok := c.Get("k")
+	if !ok || resp.Content != "hello" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("Get = %+v, %v", resp, ok)
+	}
+
+	c.Set("old", &CompletionResponse{Content: "x"}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("old"); ok {
+		t.Error("expired entry was returned")
+	}
+	if _, err := os.Stat(c.path("old")); !os.IsNotExist(err) {
+		t.Error("expired entry was not removed")
+	}
+
+	os.WriteFile(c.path("broken"), []byte("{not json"), 0o644)
+	if _, ok := c.Get("broken"); ok {
+		t.Error("corrupt entry was returned")
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("missing entry was returned")
+	}
+
+	if tmp, _ := filepath.Glob(filepath.Join(c.Dir, "*.tmp")); len(tmp) > 0 {
+		t.Errorf("temp files left behind: %v", tmp)
+	}
+}
+
+func TestCacheKeyStability(t *testing.T) {
+	tool := func(desc string) Tool {
+		return Tool{Description: desc, Execute: func(ctx context.Context, args json.RawMessage) (any, error) { return nil, nil }}
+	}
+	messages := []Message{{Role: "user", Content: "hi"}}
+	opts := func() *Options {
+		tools := map[string]Tool{}
+		for _, name := range []string{"c", "a", "b"} {
+			tools[name] = tool(name)
+		}
+		return &Options{Model: "m", Temperature: 0.2, Tools: tools, OnReasoning: func(string) {}}
+	}
+
+	key := CacheKey(messages, opts())
+	for i := 0; i < 10; i++ {
+		if CacheKey(messages, opts()) != key {
+			t.Fatal("equal requests gave different keys")
+		}
+	}
+
+	changed := opts()
+	changed.Temperature = 0.3
+	if CacheKey(messages, changed) == key {
+		t.Error("a different temperature gave the same key")
+	}
+	changed = opts()
+	changed.Tools["a"] = tool("other")
+	if CacheKey(messages, changed) == key {
+		t.Error("a different tool description gave the same key")
+	}
+	if CacheKey([]Message{{Role: "user", Content: "hello"}}, opts()) == key {
+		t.Error("different messages gave the same key")
+	}
+}
+
+func TestCachedResponsesAreNotShared(t *testing.T) {
+	p := &cachingProvider{
+		Provider: &scriptedProvider{replies: []*CompletionResponse{{Content: "hi", Usage: &Usage{TotalTokens: 4}}}},
+		cache:    NewMemoryCache(0),
+	}
+
+	first, _ := p.CreateCompletion(context.Background(), nil, &Options{})
+	first.Content = "changed"
+	first.Usage.TotalTokens = 100
+
+	second, err := p.CreateCompletion(context.Background(), nil, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Usage.TotalTokens = 200
+
+	third, _ := p.CreateCompletion(context.Background(), nil, &Options{})
+	if third.Content != "hi" || third.Usage.TotalTokens != 4 {
+		t.Errorf("cached entry = %+v %+v, changed through an earlier response", third, third.Usage)
+	}
+}
+
+func TestNoCacheBypassesTheCache(t *testing.T) {
+	provider := &scriptedProvider{replies: []*CompletionResponse{{Content: "one"}, {Content: "two"}, {Content: "three"}}}
+	client := NewSDK(provider)
+	client.SetCache(NewMemoryCache(0), 0)
+
+	ask := func(noCache bool) string {
+		resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+			Messages: []Message{{Role: "user", Content: "hi"}},
+			NoCache:  noCache,
+		})
+		if resp.Error != nil {
+			t.Fatal(resp.Error)
+		}
+		return resp.Content
+	}
+
+	if got := ask(false) + ask(false) + ask(true); got != "oneonetwo" {
+		t.Errorf("answers = %q, want the second from the cache and the third from the provider", got)
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("provider got %d requests, want 2", len(provider.requests))
+	}
+}
+
+func TestCachedStreamIsReplayed(t *testing.T) {
+	provider := &steppedProvider{steps: [][]StreamEvent{{
+		{Content: "streamed "},
+		{Content: "answer", Reasoning: "thought"},
+		{Usage: &Usage{TotalTokens: 9}},
+	}}}
+	client := NewSDK(provider)
+	client.SetCache(NewMemoryCache(0), 0)
+
+	stream := func() (string, *CompletionResponse) {
+		resp := client.ChatCompletion(context.Background(), &CompletionRequest{
+			Messages: []Message{{Role: "user", Content: "hi"}},
+			Stream:   true,
+		})
+		if resp.Error != nil {
+			t.Fatal(resp.Error)
+		}
+		content, err := io.ReadAll(resp.Stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content), resp.Stream.Result()
+	}
+
+	first, _ := stream()
+	second, result := stream()
+	if first != "streamed answer" || second != first {
+		t.Errorf("first %q, replay %q", first, second)
+	}
+	if result == nil || result.Reasoning != "thought" || result.Usage == nil || result.Usage.TotalTokens != 9 {
+		t.Errorf("replayed result = %+v", result)
+	}
+	if len(provider.requests) != 1 {
+		t.Errorf("provider got %d requests, want 1", len(provider.requests))
+	}
+}
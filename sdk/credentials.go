@@ -0,0 +1,235 @@
+// API key pools, key rotation and runtime credential providers
+
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supplies API keys at runtime so they can be rotated without rebuilding the SDK
+type CredentialProvider interface {
+	APIKeys(ctx context.Context) ([]string, error)
+}
+
+// supplies OAuth bearer tokens, implementations should cache tokens until shortly before they expire
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// adapts a function to a TokenSource
+type TokenFunc func(ctx context.Context) (string, error)
+
+func (f TokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// a fixed list of keys
+type StaticKeys []string
+
+func (k StaticKeys) APIKeys(ctx context.Context) ([]string, error) {
+	return k, nil
+}
+
+// reads keys from a file, one per line, blank lines and lines starting with # are skipped
+type FileKeys struct {
+	Path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []string
+}
+
+func (f *FileKeys) APIKeys(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	if f.keys != nil && info.ModTime().Equal(f.modTime) {
+		return f.keys, nil
+	}
+
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+
+	f.keys = keys
+	f.modTime = info.ModTime()
+	return keys, nil
+}
+
+type KeySelection int
+
+const (
+	RoundRobin           KeySelection = iota // cycle through the keys in order
+	LeastRecentlyLimited                     // prefer the key that was rate limited longest ago
+)
+
+type KeyPool struct {
+	Source          CredentialProvider
+	Selection       KeySelection
+	Quarantine      time.Duration // how long a key that returned 401 or 429 is skipped, defaults to 1 minute
+	RefreshInterval time.Duration // how often Source is asked for keys, defaults to 1 minute
+
+	mu          sync.Mutex
+	keys        []string
+	lastRefresh time.Time
+	refreshing  bool // a refresh is asking Source, other callers keep using the current keys
+	next        int
+	state       map[string]*keyState
+}
+
+type keyState struct {
+	quarantinedUntil time.Time
+	lastLimited      time.Time
+}
+
+func NewKeyPool(source CredentialProvider, selection KeySelection) *KeyPool {
+	return &KeyPool{
+		Source:    source,
+		Selection: selection,
+	}
+}
+
+// asks Source for keys when the refresh interval has passed, without holding mu while
+// it runs so a slow source such as a secret manager does not block other requests
+func (k *KeyPool) refresh(ctx context.Context) error {
+	interval := k.RefreshInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	k.mu.Lock()
+	if k.keys != nil && (k.refreshing || time.Since(k.lastRefresh) < interval) {
+		k.mu.Unlock()
+		return nil
+	}
+	k.refreshing = true
+	k.mu.Unlock()
+
+	keys, err := k.Source.APIKeys(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refreshing = false
+	if err != nil {
+		if k.keys != nil {
+			// keep using the keys we have until the source recovers
+			return nil
+		}
+		return err
+	}
+
+	k.keys = keys
+	k.lastRefresh = time.Now()
+	return nil
+}
+
+func (k *KeyPool) stateFor(key string) *keyState {
+	if k.state == nil {
+		k.state = make(map[string]*keyState)
+	}
+	st, ok := k.state[key]
+	if !ok {
+		st = &keyState{}
+		k.state[key] = st
+	}
+	return st
+}
+
+// returns the next key to use, quarantined keys are skipped unless every key is quarantined
+func (k *KeyPool) Acquire(ctx context.Context) (string, error) {
+	if err := k.refresh(ctx); err != nil {
+		return "", err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	if len(k.keys) == 0 {
+		return "", fmt.Errorf("key pool has no API keys")
+	}
+
+	var candidates []int
+	for i, key := range k.keys {
+		if now.After(k.stateFor(key).quarantinedUntil) {
+			candidates = append(candidates, i)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// every key is quarantined, use the one that comes back first
+		best := 0
+		for i, key := range k.keys {
+			if k.stateFor(key).quarantinedUntil.Before(k.stateFor(k.keys[best]).quarantinedUntil) {
+				best = i
+			}
+		}
+		return k.keys[best], nil
+	}
+
+	switch k.Selection {
+	case LeastRecentlyLimited:
+		best := candidates[0]
+		for _, i := range candidates[1:] {
+			if k.stateFor(k.keys[i]).lastLimited.Before(k.stateFor(k.keys[best]).lastLimited) {
+				best = i
+			}
+		}
+		return k.keys[best], nil
+
+	default:
+		for range k.keys {
+			i := k.next % len(k.keys)
+			k.next = i + 1
+			if now.After(k.stateFor(k.keys[i]).quarantinedUntil) {
+				return k.keys[i], nil
+			}
+		}
+		return k.keys[candidates[0]], nil
+	}
+}
+
+// records the response status for a key, 401 and 429 put the key in quarantine
+func (k *KeyPool) Report(key string, statusCode int) {
+	if statusCode != http.StatusUnauthorized && statusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	quarantine := k.Quarantine
+	if quarantine <= 0 {
+		quarantine = time.Minute
+	}
+
+	now := time.Now()
+	st := k.stateFor(key)
+	st.quarantinedUntil = now.Add(quarantine)
+	if statusCode == http.StatusTooManyRequests {
+		st.lastLimited = now
+	}
+}
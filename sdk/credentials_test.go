@@ -0,0 +1,180 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a key source whose keys can be swapped and that can be made to block
+type swappableKeys struct {
+	mu      sync.Mutex
+	keys    []string
+	err     error
+	calls   int
+	block   chan struct{} // when set, APIKeys waits on it
+	entered chan struct{} // when set, APIKeys signals it before waiting
+}
+
+func (s *swappableKeys) set(keys []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.err = keys, err
+}
+
+func (s *swappableKeys) APIKeys(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	s.calls++
+	block, entered := s.block, s.entered
+	keys, err := s.keys, s.err
+	s.mu.Unlock()
+
+	if entered != nil {
+		entered <- struct{}{}
+	}
+	if block != nil {
+		<-block
+	}
+	return keys, err
+}
+
+func acquireAll(t *testing.T, pool *KeyPool, n int) string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		key, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, key)
+	}
+	return strings.Join(got, " ")
+}
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	pool := NewKeyPool(StaticKeys{"a", "b", "c"}, RoundRobin)
+	if got := acquireAll(t, pool, 4); got != "a b c a" {
+		t.Errorf("keys = %q", got)
+	}
+}
+
+func TestKeyPoolPicksUpRotatedKeys(t *testing.T) {
+	source := &swappableKeys{keys: []string{"old"}}
+	pool := &KeyPool{Source: source, RefreshInterval: time.Millisecond}
+	if got := acquireAll(t, pool, 1); got != "old" {
+		t.Fatalf("key = %q", got)
+	}
+
+	source.set([]string{"new"}, nil)
+	time.Sleep(5 * time.Millisecond)
+	if got := acquireAll(t, pool, 1); got != "new" {
+		t.Errorf("key after rotation = %q", got)
+	}
+
+	// a failing source keeps the keys the pool already has
+	source.set(nil, errors.New("secret manager down"))
+	time.Sleep(5 * time.Millisecond)
+	if got := acquireAll(t, pool, 1); got != "new" {
+		t.Errorf("key while the source fails = %q", got)
+	}
+}
+
+func TestKeyPoolReturnsFirstSourceError(t *testing.T) {
+	pool := NewKeyPool(&swappableKeys{err: errors.New("no access")}, RoundRobin)
+	if _, err := pool.Acquire(context.Background()); err == nil || err.Error() != "no access" {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := NewKeyPool(StaticKeys{}, RoundRobin).Acquire(context.Background()); err == nil {
+		t.Error("empty pool returned a key")
+	}
+}
+
+func TestKeyPoolQuarantine(t *testing.T) {
+	pool := NewKeyPool(StaticKeys{"a", "b", "c"}, RoundRobin)
+	pool.Report("a", http.StatusUnauthorized)
+	pool.Report("b", http.StatusTooManyRequests)
+	pool.Report("c", http.StatusInternalServerError)
+
+	if got := acquireAll(t, pool, 3); got != "c c c" {
+		t.Errorf("keys = %q, want the keys that got 401 and 429 skipped", got)
+	}
+
+	// with every key quarantined the one that comes back first is used
+	pool.Report("c", http.StatusTooManyRequests)
+	if got := acquireAll(t, pool, 1); got != "a" {
+		t.Errorf("key with every key quarantined = %q", got)
+	}
+}
+
+func TestKeyPoolRecoversAfterQuarantine(t *testing.T) {
+	pool := &KeyPool{Source: StaticKeys{"a", "b"}, Quarantine: time.Millisecond}
+	pool.Report("a", http.StatusTooManyRequests)
+	if got := acquireAll(t, pool, 2); got != "b b" {
+		t.Errorf("keys during quarantine = %q", got)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if got := acquireAll(t, pool, 2); got != "a b" {
+		t.Errorf("keys after quarantine = %q", got)
+	}
+}
+
+func TestKeyPoolLeastRecentlyLimited(t *testing.T) {
+	pool := &KeyPool{Source: StaticKeys{"a", "b", "c"}, Selection: LeastRecentlyLimited, Quarantine: time.Millisecond}
+	pool.Report("a", http.StatusTooManyRequests)
+	time.Sleep(2 * time.Millisecond)
+	pool.Report("c", http.StatusTooManyRequests)
+	time.Sleep(2 * time.Millisecond)
+	pool.Report("b", http.StatusTooManyRequests)
+	time.Sleep(5 * time.Millisecond)
+
+	if got := acquireAll(t, pool, 2); got != "a a" {
+		t.Errorf("keys = %q, want the key limited longest ago", got)
+	}
+}
+
+func TestKeyPoolRefreshDoesNotBlockAcquire(t *testing.T) {
+	source := &swappableKeys{keys: []string{"a"}}
+	pool := &KeyPool{Source: source, RefreshInterval: time.Millisecond}
+	acquireAll(t, pool, 1)
+
+	release := make(chan struct{})
+	source.mu.Lock()
+	source.block, source.entered = release, make(chan struct{}, 1)
+	entered := source.entered
+	source.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	slow := make(chan string)
+	go func() {
+		key, _ := pool.Acquire(context.Background())
+		slow <- key
+	}()
+	<-entered
+
+	done := make(chan string)
+	go func() {
+		key, _ := pool.Acquire(context.Background())
+		done <- key
+	}()
+	select {
+	case key := <-done:
+		if key != "a" {
+			t.Errorf("key during refresh = %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire blocked while another caller was refreshing the keys")
+	}
+
+	close(release)
+	if key := <-slow; key != "a" {
+		t.Errorf("refreshing caller got %q", key)
+	}
+	if source.calls != 2 {
+		t.Errorf("source asked %d times, want 2", source.calls)
+	}
+}
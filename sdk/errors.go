@@ -13,3 +13,34 @@ type APIError struct {
 func (e *APIError) Error() string {
 	return fmt.Sprintf("APIError: %d - %s", e.StatusCode, e.Message)
 }
+
+// returned when a request would exceed a configured budget
+type BudgetExceededError struct {
+	Limit string // "tokens", "cost" or "requests"
+	Used  float64
+	Max   float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("BudgetExceededError: %s budget exceeded (%g used of %g)", e.Limit, e.Used, e.Max)
+}
+
+// returned when the tool loop used all its steps without a final answer
+type MaxToolStepsError struct {
+	Steps int
+}
+
+func (e *MaxToolStepsError) Error() string {
+	return fmt.Sprintf("reached maximum tool steps (%d) without final answer", e.Steps)
+}
+
+// returned when a response is blocked by the provider's safety or content filters
+type ContentBlockedError struct {
+	Reason string
+	Body   []byte
+	Safety []SafetyRating // the ratings that led to the block, where reported
+}
+
+func (e *ContentBlockedError) Error() string {
+	return fmt.Sprintf("content blocked by safety filters. Finish Reason: %s. Response Body: %s", e.Reason, string(e.Body))
+}
@@ -1,14 +1,71 @@
 package sdk
 
 type Message struct {
-	Role       string            `json:"role"`
-	Content    string            `json:"content"`
-	ToolCallID string            `json:"tool_call_id,omitempty"`
-	ToolCalls  []ToolCallRequest `json:"tool_calls,omitempty"`
+	Role         string            `json:"role"`
+	Content      string            `json:"content"`
+	Images       []string          `json:"images,omitempty"` // base64 encoded images, sent by providers with image input (Ollama)
+	ToolCallID   string            `json:"tool_call_id,omitempty"`
+	ToolCalls    []ToolCallRequest `json:"tool_calls,omitempty"`
+	CacheControl bool              `json:"cache_control,omitempty"` // prompt cache breakpoint after this message, where supported
+	Thinking     []ThinkingBlock   `json:"thinking,omitempty"`      // reasoning blocks sent back to providers that require them
 }
 
 type CompletionResponse struct {
 	Content   string
 	ToolCalls []ToolCallRequest
 	Role      string
+	Usage     *Usage
+	Reasoning string          // reasoning / thinking text, kept apart from Content
+	Thinking  []ThinkingBlock // raw thinking blocks, including signatures
+	Citations []Citation      // spans of Content grounded in the request documents
+	Safety    []SafetyRating  // safety ratings of the prompt and response, where reported (Gemini)
+}
+
+// a document the model can ground its answer in and cite
+type Document struct {
+	ID   string            `json:"id,omitempty"`
+	Data map[string]string `json:"data"` // e.g. title, snippet, url
+}
+
+// a span of the response content supported by one or more documents
+type Citation struct {
+	Start       int      `json:"start"` // character offsets into the content, not bytes
+	End         int      `json:"end"`
+	Text        string   `json:"text"`
+	DocumentIDs []string `json:"document_ids,omitempty"`
+}
+
+// how likely a prompt or response falls in a harm category
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// a reasoning block, providers sign these and expect them back unchanged in tool loops
+type ThinkingBlock struct {
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Redacted  string `json:"redacted,omitempty"` // encrypted thinking returned instead of text
+}
+
+// token usage reported by the provider, or estimated when it is missing
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`  // prompt tokens read from the provider prompt cache
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"` // prompt tokens written to the provider prompt cache
+}
+
+// adds the token counts of other to u
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
 }
@@ -2,12 +2,102 @@
 
 package sdk
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Options struct {
 	Model               string          `json:"model,omitempty"`
 	SystemPrompt        string          `json:"system_prompt,omitempty"`
 	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
 	ReasoningEffort     string          `json:"reasoning_effort,omitempty"`
+	Reasoning           *Reasoning      `json:"reasoning,omitempty"`
 	Temperature         float32         `json:"temperature,omitempty"`
+	TopP                float32         `json:"top_p,omitempty"`
+	TopK                int             `json:"top_k,omitempty"`
+	StopSequences       []string        `json:"stop_sequences,omitempty"`
+	User                string          `json:"user,omitempty"`
+	Documents           []Document      `json:"documents,omitempty"`
+	ResponseFormat      json.RawMessage `json:"response_format,omitempty"`
+	KeepAlive           string          `json:"keep_alive,omitempty"`
+	ModelOptions        map[string]any  `json:"model_options,omitempty"`
 	Tools               map[string]Tool `json:"tools,omitempty"`
 	MaxToolSteps        int             `json:"max_tool_steps,omitempty"`
+	ToolChoice          string          `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool           `json:"parallel_tool_calls,omitempty"`
+	ToolConcurrency     int             `json:"tool_concurrency,omitempty"`
+	ToolTimeout         time.Duration   `json:"tool_timeout,omitempty"`
+	CacheSystemPrompt   bool            `json:"cache_system_prompt,omitempty"`
+	OnReasoning         func(string)    `json:"-"`
+}
+
+// tool choice values, any other value forces the tool with that name
+const (
+	ToolChoiceAuto     = "auto"     // the model decides, the default
+	ToolChoiceNone     = "none"     // the model must not call tools
+	ToolChoiceRequired = "required" // the model must call at least one tool
+)
+
+// returns options for the steps after the first, a forced tool choice only applies to the first step
+func (o *Options) afterFirstStep() *Options {
+	if o.ToolChoice == "" || o.ToolChoice == ToolChoiceAuto || o.ToolChoice == ToolChoiceNone {
+		return o
+	}
+	next := *o
+	next.ToolChoice = ToolChoiceAuto
+	return &next
+}
+
+// reasoning / extended thinking configuration
+type Reasoning struct {
+	Effort       string `json:"effort,omitempty"`        // "low", "medium" or "high"
+	BudgetTokens int    `json:"budget_tokens,omitempty"` // thinking token budget, derived from Effort when 0
+	Exclude      bool   `json:"exclude,omitempty"`       // reason but do not return the reasoning text, where supported
+}
+
+// returns the reasoning configuration, falling back to ReasoningEffort, nil when reasoning is not requested
+func (o *Options) ReasoningConfig() *Reasoning {
+	if o == nil {
+		return nil
+	}
+	if o.Reasoning != nil {
+		return o.Reasoning
+	}
+	if o.ReasoningEffort != "" {
+		return &Reasoning{Effort: o.ReasoningEffort}
+	}
+	return nil
+}
+
+// returns the thinking token budget, mapping the effort level when no budget is set
+func (r *Reasoning) Budget() int {
+	if r.BudgetTokens > 0 {
+		return r.BudgetTokens
+	}
+	switch r.Effort {
+	case "low":
+		return 1024
+	case "high":
+		return 16384
+	default:
+		return 4096
+	}
+}
+
+// returns the effort level, mapping the token budget when no effort is set
+func (r *Reasoning) EffortLevel() string {
+	if r.Effort != "" {
+		return r.Effort
+	}
+	switch {
+	case r.BudgetTokens <= 0:
+		return "medium"
+	case r.BudgetTokens <= 2048:
+		return "low"
+	case r.BudgetTokens <= 8192:
+		return "medium"
+	default:
+		return "high"
+	}
 }
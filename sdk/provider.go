@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 )
 
 type Provider interface {
@@ -16,6 +17,9 @@ type Provider interface {
 
 type SDK struct {
 	provider Provider
+	budget   *Budget
+	cache    Cache
+	cacheTTL time.Duration
 }
 
 func NewSDK(provider Provider) *SDK {
@@ -24,10 +28,56 @@ func NewSDK(provider Provider) *SDK {
 	}
 }
 
+// sets a budget enforced on every request made through this SDK
+func (sdk *SDK) SetBudget(budget *Budget) {
+	sdk.budget = budget
+}
+
+// sets a response cache used by every request, a ttl of 0 keeps entries until evicted
+func (sdk *SDK) SetCache(cache Cache, ttl time.Duration) {
+	sdk.cache = cache
+	sdk.cacheTTL = ttl
+}
+
+// implemented by providers that support client side rate limiting
+type RateLimitedProvider interface {
+	SetRateLimiter(limiter *RateLimiter)
+}
+
+// sets a rate limiter that is waited on before every API call, returns an error if the provider does not support it
+func (sdk *SDK) SetRateLimiter(limiter *RateLimiter) error {
+	p, ok := sdk.provider.(RateLimitedProvider)
+	if !ok {
+		return fmt.Errorf("rate limiting not supported by this provider")
+	}
+	p.SetRateLimiter(limiter)
+	return nil
+}
+
+// implemented by providers that can rotate between pooled API keys
+type KeyPooledProvider interface {
+	SetKeyPool(pool *KeyPool)
+}
+
+// sets a key pool used instead of the provider API key, returns an error if the provider does not support it
+func (sdk *SDK) SetKeyPool(pool *KeyPool) error {
+	p, ok := sdk.provider.(KeyPooledProvider)
+	if !ok {
+		return fmt.Errorf("key pools not supported by this provider")
+	}
+	p.SetKeyPool(pool)
+	return nil
+}
+
 type Response struct {
-	Content string
-	Stream  *Stream
-	Error   error
+	Content   string
+	Reasoning string // reasoning / thinking text of all steps, empty for streams
+	Stream    *Stream
+	Citations []Citation     // citations of Content, nil for streams
+	Safety    []SafetyRating // safety ratings of the prompt and the final response, nil for streams
+	Usage     *Usage         // aggregated over all steps, nil for streams
+	Paused    *LoopState     // set when the tool loop paused for approval, pass it back as Resume to continue
+	Error     error
 }
 
 type Stream struct {
@@ -42,17 +92,49 @@ func (s *Stream) Close() error {
 	return s.reader.Close()
 }
 
+// returns the reasoning text received so far, complete once the stream has been drained
+func (s *Stream) Reasoning() string {
+	if result := s.Result(); result != nil {
+		return result.Reasoning
+	}
+	return ""
+}
+
+// returns everything the stream collected apart from the content text, nil if the provider does not report it
+func (s *Stream) Result() *CompletionResponse {
+	return streamResultOf(s.reader)
+}
+
 type CompletionRequest struct {
-	Messages        []Message                                   // conversation history
-	Model           string                                      // model name
-	SystemPrompt    string                                      // initial system prompt
-	MaxTokens       int                                         // max tokens for completion
-	Temperature     float32                                     // sampling temperature
-	ReasoningEffort string                                      // e.g., "low", "medium", "high"
-	Stream          bool                                        // whether to stream the response
-	Tools           map[string]Tool                             // available tools for tool calls
-	MaxToolSteps    int                                         // for preventing infinite loop error, defaults to 5
-	OnToolCall      func(toolName string, args json.RawMessage) // for ui callbacks
+	Messages          []Message                                   // conversation history
+	Model             string                                      // model name
+	SystemPrompt      string                                      // initial system prompt
+	MaxTokens         int                                         // max tokens for completion
+	Temperature       float32                                     // sampling temperature
+	TopP              float32                                     // nucleus sampling, where supported (Anthropic, Gemini)
+	TopK              int                                         // top k sampling, where supported (Anthropic, Gemini)
+	StopSequences     []string                                    // sequences that end generation, where supported (Anthropic, Gemini)
+	User              string                                      // opaque end user id for abuse detection, where supported (Anthropic)
+	Documents         []Document                                  // documents to ground the answer in, where supported (Cohere)
+	ResponseFormat    json.RawMessage                             // "json" or a JSON schema the response must follow, where supported (Ollama)
+	KeepAlive         string                                      // how long the model stays loaded after the request, where supported (Ollama)
+	ModelOptions      map[string]any                              // model options such as num_ctx or seed, where supported (Ollama)
+	ReasoningEffort   string                                      // e.g., "low", "medium", "high"
+	Reasoning         *Reasoning                                  // reasoning / thinking configuration, overrides ReasoningEffort
+	OnReasoning       func(text string)                           // receives reasoning chunks as they stream
+	Stream            bool                                        // whether to stream the response
+	Tools             map[string]Tool                             // available tools for tool calls
+	MaxToolSteps      int                                         // for preventing infinite loop error, defaults to 5
+	ToolChoice        string                                      // "auto", "none", "required" or a tool name, forced choices apply to the first step only
+	ParallelToolCalls *bool                                       // allow several tool calls in one step, where supported
+	ToolConcurrency   int                                         // max tool calls executed at once within a step, defaults to 1
+	ToolTimeout       time.Duration                               // timeout for each tool call, 0 means only ctx applies
+	OnToolCall        func(toolName string, args json.RawMessage) // for ui callbacks
+	OnApproval        ApprovalFunc                                // approves, denies, edits or pauses calls to tools that require approval
+	Resume            *LoopState                                  // resumes a paused tool loop, Messages is ignored when set
+	Budget            *Budget                                     // per request budget, enforced with the SDK budget
+	NoCache           bool                                        // bypass the response cache for this request
+	CacheSystemPrompt bool                                        // prompt cache breakpoint after the system prompt, where supported
 }
 
 func (sdk *SDK) ChatCompletion(ctx context.Context, req *CompletionRequest) *Response {
@@ -67,30 +149,81 @@ func (sdk *SDK) ChatCompletion(ctx context.Context, req *CompletionRequest) *Res
 		SystemPrompt:        req.SystemPrompt,
 		MaxCompletionTokens: req.MaxTokens,
 		Temperature:         req.Temperature,
+		TopP:                req.TopP,
+		TopK:                req.TopK,
+		StopSequences:       req.StopSequences,
+		User:                req.User,
+		Documents:           req.Documents,
+		ResponseFormat:      req.ResponseFormat,
+		KeepAlive:           req.KeepAlive,
+		ModelOptions:        req.ModelOptions,
 		ReasoningEffort:     req.ReasoningEffort,
+		Reasoning:           req.Reasoning,
+		OnReasoning:         req.OnReasoning,
 		Tools:               req.Tools,
 		MaxToolSteps:        req.MaxToolSteps,
+		ToolChoice:          req.ToolChoice,
+		ParallelToolCalls:   req.ParallelToolCalls,
+		ToolConcurrency:     req.ToolConcurrency,
+		ToolTimeout:         req.ToolTimeout,
+		CacheSystemPrompt:   req.CacheSystemPrompt,
 	}
 
 	hasTools := len(opts.Tools) > 0
 
+	sdk = sdk.forRequest(req)
+
+	runner := &toolRunner{
+		tools:       req.Tools,
+		onToolCall:  req.OnToolCall,
+		onApproval:  req.OnApproval,
+		concurrency: req.ToolConcurrency,
+		timeout:     req.ToolTimeout,
+	}
+
 	switch {
 	case req.Stream && hasTools:
-		return sdk.streamingCompletionWithTools(ctx, req.Messages, opts, req.Tools, req.OnToolCall)
+		return sdk.streamingCompletionWithTools(ctx, req.Messages, opts, runner, req.Resume)
 	case req.Stream:
 		return sdk.streamingCompletion(ctx, req.Messages, opts)
 
 	case hasTools:
-		return sdk.chatCompletionWithTools(ctx, req.Messages, opts, req.Tools, req.OnToolCall)
+		return sdk.chatCompletionWithTools(ctx, req.Messages, opts, runner, req.Resume)
 
 	default:
 		return sdk.simpleCompletion(ctx, req.Messages, opts)
 	}
 }
 
+// returns a copy of the SDK whose provider enforces the budgets and serves the cache for this request
+func (sdk *SDK) forRequest(req *CompletionRequest) *SDK {
+	clone := *sdk
+
+	var budgets []*Budget
+	if sdk.budget != nil {
+		budgets = append(budgets, sdk.budget)
+	}
+	if req.Budget != nil && req.Budget != sdk.budget {
+		budgets = append(budgets, req.Budget)
+	}
+	if len(budgets) > 0 {
+		clone.provider = &budgetProvider{Provider: clone.provider, budgets: budgets}
+	}
+
+	// cache hits are served before the budget is charged
+	if sdk.cache != nil && !req.NoCache {
+		clone.provider = &cachingProvider{Provider: clone.provider, cache: sdk.cache, ttl: sdk.cacheTTL}
+	}
+
+	return &clone
+}
+
 func (sdk *SDK) simpleCompletion(ctx context.Context, messages []Message, opts *Options) *Response {
 	compResp, err := sdk.provider.CreateCompletion(ctx, messages, opts)
-	return &Response{Content: compResp.Content, Error: err}
+	if err != nil {
+		return &Response{Error: err}
+	}
+	return &Response{Content: compResp.Content, Reasoning: compResp.Reasoning, Citations: compResp.Citations, Safety: compResp.Safety, Usage: compResp.Usage}
 }
 
 func (sdk *SDK) streamingCompletion(ctx context.Context, messages []Message, opts *Options) *Response {
@@ -105,148 +238,115 @@ func (sdk *SDK) chatCompletionWithTools(
 	ctx context.Context,
 	initialMessages []Message,
 	opts *Options,
-	tools map[string]Tool,
-	onToolCall func(string, json.RawMessage),
+	runner *toolRunner,
+	resume *LoopState,
 ) *Response {
-	messages := append([]Message{}, initialMessages...)
-
-	for step := 0; step < opts.MaxToolSteps; step++ {
-		compResp, err := sdk.provider.CreateCompletion(ctx, messages, opts)
-
-		if err != nil {
-			return &Response{Error: err}
-		}
-
-		if len(compResp.ToolCalls) == 0 {
-			return &Response{Content: compResp.Content}
-		}
-
-		messages = append(messages, Message{
-			Role:      "assistant",
-			Content:   compResp.Content,
-			ToolCalls: compResp.ToolCalls,
-		})
-
-		for _, toolCall := range compResp.ToolCalls {
-			tool, exists := tools[toolCall.Name]
-			if !exists {
-				messages = append(messages, Message{
-					Role:       "tool",
-					ToolCallID: toolCall.ID,
-					Content:    fmt.Sprintf(`{"error": "Tool" '%s' not found"}`, toolCall.Name),
-				})
-				continue
-			}
-
-			if onToolCall != nil {
-				onToolCall(toolCall.Name, toolCall.Arguments)
-			}
+	loop := &toolLoop{
+		provider: sdk.provider,
+		runner:   runner,
+		stopWhen: []StopCondition{MaxSteps(opts.MaxToolSteps)},
+	}
 
-			result, err := tool.Execute(ctx, toolCall.Arguments)
+	result, err := loop.run(ctx, initialMessages, opts, resume)
+	resp := &Response{Reasoning: result.Reasoning, Usage: result.Usage, Paused: result.Paused, Error: err}
+	switch {
+	case err != nil:
+	case result.FinishReason == FinishCondition:
+		resp.Error = &MaxToolStepsError{Steps: opts.MaxToolSteps}
+	default:
+		resp.Content = result.Content
+		resp.Citations = result.Steps[len(result.Steps)-1].Response.Citations
+		resp.Safety = result.Steps[len(result.Steps)-1].Response.Safety
+	}
+	return resp
+}
 
-			var resultContent string
-			if err != nil {
-				resultContent = fmt.Sprintf(`{"error": "%s"}`, err.Error())
-			} else {
-				resultBytes, marshalErr := json.Marshal(result)
-				if marshalErr != nil {
-					resultContent = fmt.Sprintf(`{"error": "Failes to marshal toolCall result: %s"}`, marshalErr.Error())
-				} else {
-					resultContent = string(resultBytes)
-				}
-			}
+// runs the pending tool calls of a paused loop, returns the conversation to continue from or the state when it paused again
+func resumeToolLoop(ctx context.Context, runner *toolRunner, resume *LoopState) ([]Message, *LoopState) {
+	messages := append([]Message{}, resume.Messages...)
 
-			messages = append(messages, Message{
-				Role:       "tool",
-				ToolCallID: toolCall.ID,
-				Content:    resultContent,
-			})
-		}
+	decisions := map[string]ApprovalDecision{}
+	for id, d := range resume.Decisions {
+		decisions[id] = d
 	}
-	return &Response{
-		Error: fmt.Errorf("reached maximum tool steps (%d) without final answer", opts.MaxToolSteps),
+
+	results, paused := runner.run(ctx, resume.Pending, decisions)
+	if paused {
+		return nil, &LoopState{Messages: messages, Pending: resume.Pending, Decisions: decisions, Step: resume.Step}
 	}
+	return append(messages, results...), nil
 }
 
 func (sdk *SDK) streamingCompletionWithTools(
 	ctx context.Context,
 	initialMessages []Message,
 	opts *Options,
-	tools map[string]Tool,
-	onToolCall func(toolName string, args json.RawMessage),
+	runner *toolRunner,
+	resume *LoopState,
 ) *Response {
 	messages := append([]Message{}, initialMessages...)
 
-	r, w := io.Pipe()
+	pipe := NewEventPipe(opts.OnReasoning)
 
 	go func() {
-		defer w.Close()
+		start := 0
+		if resume != nil {
+			var state *LoopState
+			messages, state = resumeToolLoop(ctx, runner, resume)
+			if state != nil {
+				pipe.Finish(&ToolLoopPausedError{State: state})
+				return
+			}
+			start = resume.Step + 1
+			opts = opts.afterFirstStep()
+		}
 
-		for step := 0; step < opts.MaxToolSteps; step++ {
-			compResp, err := sdk.provider.CreateCompletion(ctx, messages, opts)
+		// every step is streamed, the tool calls it collected decide whether to loop again
+		for step := start; step < opts.MaxToolSteps; step++ {
+			stream, err := sdk.provider.CreateCompletionStream(ctx, messages, opts)
 			if err != nil {
-				w.CloseWithError(err)
+				pipe.Finish(err)
+				return
+			}
+			_, err = io.Copy(contentWriter{pipe}, stream)
+			stream.Close()
+			if err != nil {
+				pipe.Finish(err)
 				return
 			}
 
-			if len(compResp.ToolCalls) > 0 {
-				if compResp.Content != "" {
-					w.Write([]byte(compResp.Content))
-				}
-
-				messages = append(messages, Message{
-					Role:      "assistant",
-					Content:   compResp.Content,
-					ToolCalls: compResp.ToolCalls,
-				})
-
-				for _, toolCall := range compResp.ToolCalls {
-					tool, exists := tools[toolCall.Name]
-					if !exists {
-						messages = append(messages, Message{
-							Role:       "tool",
-							ToolCallID: toolCall.ID,
-							Content:    fmt.Sprintf(`{"error": "Tool" '%s' not found"}`, toolCall.Name),
-						})
-						continue
-					}
-
-					if onToolCall != nil {
-						onToolCall(toolCall.Name, toolCall.Arguments)
-					}
-
-					result, err := tool.Execute(ctx, toolCall.Arguments)
-
-					var resultContent string
-					if err != nil {
-						resultContent = fmt.Sprintf(`{"error": "%s"}`, err.Error())
-					} else {
-						resultBytes, marshalErr := json.Marshal(result)
-						if marshalErr != nil {
-							resultContent = fmt.Sprintf(`{"error": "Failes to marshal toolCall result: %s"}`, marshalErr.Error())
-						} else {
-							resultContent = string(resultBytes)
-						}
-					}
-
-					messages = append(messages, Message{
-						Role:       "tool",
-						ToolCallID: toolCall.ID,
-						Content:    resultContent,
-					})
+			// a stream that collects no result cannot report tool calls, so it is the answer
+			result := streamResultOf(stream)
+			if result == nil || len(result.ToolCalls) == 0 {
+				if result != nil {
+					pipe.merge(result)
 				}
+				pipe.Finish(nil)
+				return
 			}
-			// no tool calls - stream the response
-			stream, err := sdk.provider.CreateCompletionStream(ctx, messages, opts)
-			if err != nil {
-				w.CloseWithError(err)
+
+			// the calls are run here, so the caller only sees their reasoning and usage
+			calls := result.ToolCalls
+			pipe.merge(&CompletionResponse{Reasoning: result.Reasoning, Thinking: result.Thinking, Usage: result.Usage})
+
+			messages = append(messages, Message{
+				Role:      "assistant",
+				Content:   result.Content,
+				ToolCalls: calls,
+				Thinking:  result.Thinking,
+			})
+
+			decisions := map[string]ApprovalDecision{}
+			results, paused := runner.run(ctx, calls, decisions)
+			if paused {
+				state := &LoopState{Messages: messages, Pending: calls, Decisions: decisions, Step: step}
+				pipe.Finish(&ToolLoopPausedError{State: state})
 				return
 			}
-			io.Copy(w, stream)
-			stream.Close()
-			return
+			messages = append(messages, results...)
+			opts = opts.afterFirstStep()
 		}
-		w.CloseWithError(fmt.Errorf("max tool calls reached"))
+		pipe.Finish(&MaxToolStepsError{Steps: opts.MaxToolSteps})
 	}()
-	return &Response{Stream: &Stream{reader: r}}
+	return &Response{Stream: &Stream{reader: pipe}}
 }
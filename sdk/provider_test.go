@@ -0,0 +1,87 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// streams the scripted events of one step per request and records every request
+type steppedProvider struct {
+	scriptedProvider
+	steps [][]StreamEvent
+}
+
+func (p *steppedProvider) CreateCompletionStream(ctx context.Context, messages []Message, opts *Options) (io.ReadCloser, error) {
+	p.requests = append(p.requests, messages)
+	events := p.steps[0]
+	p.steps = p.steps[1:]
+
+	pipe := NewEventPipe(nil)
+	go func() {
+		for _, evt := range events {
+			if err := pipe.Emit(evt); err != nil {
+				pipe.Finish(err)
+				return
+			}
+		}
+		pipe.Finish(nil)
+	}()
+	return pipe, nil
+}
+
+func TestStreamingToolLoopRunsStreamedToolCalls(t *testing.T) {
+	calls := 0
+	weather := Tool{
+		Description: "current weather",
+		Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+			calls++
+			return "sunny", nil
+		},
+	}
+
+	// CreateCompletion has no replies, so a non-streaming request fails the test
+	provider := &steppedProvider{steps: [][]StreamEvent{
+		{
+			{Content: "Checking. "},
+			{ToolCall: &ToolCallRequest{ID: "c1", Name: "weather", Arguments: json.RawMessage(`{}`)}},
+			{Usage: &Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}},
+		},
+		{
+			{Content: "It is sunny."},
+			{Usage: &Usage{PromptTokens: 9, CompletionTokens: 4, TotalTokens: 13}},
+		},
+	}}
+
+	resp := NewSDK(provider).ChatCompletion(context.Background(), &CompletionRequest{
+		Messages: []Message{{Role: "user", Content: "weather?"}},
+		Stream:   true,
+		Tools:    map[string]Tool{"weather": weather},
+	})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	content, err := io.ReadAll(resp.Stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "Checking. It is sunny." {
+		t.Errorf("content = %q", content)
+	}
+	if calls != 1 {
+		t.Errorf("tool ran %d times, want 1", calls)
+	}
+	if len(provider.requests) != 2 || provider.requests[1][len(provider.requests[1])-1].Role != "tool" {
+		t.Fatalf("second request does not end with the tool result: %+v", provider.requests)
+	}
+
+	result := resp.Stream.Result()
+	if len(result.ToolCalls) != 0 {
+		t.Errorf("result reports executed tool calls %+v", result.ToolCalls)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 20 {
+		t.Errorf("usage = %+v, want both steps", result.Usage)
+	}
+}
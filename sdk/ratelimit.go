@@ -0,0 +1,184 @@
+// client side rate limiting with token buckets keyed by provider and model
+
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimiter struct {
+	RequestsPerMinute int  // 0 means unlimited
+	TokensPerMinute   int  // 0 means unlimited
+	Adaptive          bool // adapt to x-ratelimit-* and retry-after response headers
+
+	mu      sync.Mutex
+	buckets map[string]*limitBuckets
+}
+
+type limitBuckets struct {
+	requests     *tokenBucket
+	tokens       *tokenBucket
+	blockedUntil time.Time
+}
+
+type tokenBucket struct {
+	capacity     float64
+	available    float64
+	perSecond    float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	return &RateLimiter{
+		RequestsPerMinute: requestsPerMinute,
+		TokensPerMinute:   tokensPerMinute,
+		Adaptive:          true,
+	}
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		last:      now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.available = min(b.capacity, b.available+elapsed*b.perSecond)
+		b.last = now
+	}
+}
+
+// returns how long to wait until n tokens are available
+func (b *tokenBucket) delay(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	b.refill(now)
+	n = min(n, b.capacity)
+	if b.available >= n {
+		return 0
+	}
+	return time.Duration((n - b.available) / b.perSecond * float64(time.Second))
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b != nil {
+		b.available -= min(n, b.capacity)
+	}
+}
+
+// applies the remaining count and reset time reported by the server
+func (b *tokenBucket) adapt(now time.Time, remaining string, reset string) {
+	if b == nil {
+		return
+	}
+	if r, err := strconv.ParseFloat(strings.TrimSpace(remaining), 64); err == nil {
+		b.refill(now)
+		b.available = min(b.available, r)
+		if r <= 0 {
+			if d, ok := parseResetDuration(reset, now); ok {
+				b.blockedUntil = now.Add(d)
+			}
+		}
+	}
+}
+
+func (l *RateLimiter) bucketsFor(key string, now time.Time) *limitBuckets {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*limitBuckets)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &limitBuckets{
+			requests: newTokenBucket(l.RequestsPerMinute, now),
+			tokens:   newTokenBucket(l.TokensPerMinute, now),
+		}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// blocks until a request using the given number of tokens is allowed for key
+func (l *RateLimiter) Wait(ctx context.Context, key string, tokens int) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		b := l.bucketsFor(key, now)
+		wait := max(b.blockedUntil.Sub(now), b.requests.delay(now, 1), b.tokens.delay(now, float64(tokens)))
+		if wait <= 0 {
+			b.requests.take(1)
+			b.tokens.take(float64(tokens))
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// adapts the limits for key from the response headers
+func (l *RateLimiter) Observe(key string, resp *http.Response) {
+	if !l.Adaptive || resp == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.bucketsFor(key, now)
+	h := resp.Header
+
+	b.requests.adapt(now, h.Get("x-ratelimit-remaining-requests"), h.Get("x-ratelimit-reset-requests"))
+	b.tokens.adapt(now, h.Get("x-ratelimit-remaining-tokens"), h.Get("x-ratelimit-reset-tokens"))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d, ok := parseResetDuration(h.Get("retry-after"), now); ok {
+			b.blockedUntil = now.Add(d)
+		}
+	}
+}
+
+// parses reset values such as "1s", "6m0s", "30" or an RFC 3339 / HTTP date
+func parseResetDuration(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, true
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Sub(now), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
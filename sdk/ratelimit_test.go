@@ -0,0 +1,181 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTokenBucketDelay(t *testing.T) {
+	b := newTokenBucket(60, epoch) // one per second
+	if d := b.delay(epoch, 60); d != 0 {
+		t.Fatalf("delay for a full bucket = %v", d)
+	}
+	b.take(60)
+
+	for _, tc := range []struct {
+		after time.Duration
+		n     float64
+		want  time.Duration
+	}{
+		{0, 1, time.Second},
+		{500 * time.Millisecond, 1, 500 * time.Millisecond},
+		{time.Second, 3, 2 * time.Second},
+		{2 * time.Second, 1, 0},
+		// a request larger than the bucket waits for a full bucket, not forever
+		{2 * time.Second, 1000, 58 * time.Second},
+	} {
+		if d := b.delay(epoch.Add(tc.after), tc.n); d != tc.want {
+			t.Errorf("delay(+%v, %v) = %v, want %v", tc.after, tc.n, d, tc.want)
+		}
+	}
+
+	if d := (*tokenBucket)(nil).delay(epoch, 1e9); d != 0 {
+		t.Errorf("unlimited bucket delay = %v", d)
+	}
+}
+
+func TestTokenBucketAdapt(t *testing.T) {
+	b := newTokenBucket(100, epoch)
+	b.adapt(epoch, "5", "10s")
+	if d := b.delay(epoch, 10); d != 3*time.Second {
+		t.Errorf("delay after the server reported 5 remaining = %v, want 3s", d)
+	}
+
+	b.adapt(epoch, "0", "6m0s")
+	if d := b.delay(epoch.Add(time.Minute), 1); d != 5*time.Minute {
+		t.Errorf("delay after the server reported none remaining = %v, want the rest of the reset", d)
+	}
+
+	b = newTokenBucket(100, epoch)
+	b.adapt(epoch, "", "1s")
+	b.adapt(epoch, "many", "1s")
+	if d := b.delay(epoch, 100); d != 0 {
+		t.Errorf("missing or invalid headers changed the bucket, delay = %v", d)
+	}
+}
+
+func TestParseResetDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"1s":                            time.Second,
+		"6m0s":                          6 * time.Minute,
+		"30":                            30 * time.Second,
+		"1.5":                           1500 * time.Millisecond,
+		"2025-01-01T00:00:20Z":          20 * time.Second,
+		"Wed, 01 Jan 2025 00:01:00 GMT": time.Minute,
+	} {
+		if d, ok := parseResetDuration(value, epoch); !ok || d != want {
+			t.Errorf("parseResetDuration(%q) = %v, %v, want %v", value, d, ok, want)
+		}
+	}
+	for _, value := range []string{"", "soon"} {
+		if _, ok := parseResetDuration(value, epoch); ok {
+			t.Errorf("parseResetDuration(%q) succeeded", value)
+		}
+	}
+}
+
+// waits on l with a short deadline and reports whether the request was allowed
+func allowed(l *RateLimiter, key string, tokens int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	return l.Wait(ctx, key, tokens) == nil
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	l := NewRateLimiter(2, 0)
+	if !allowed(l, "p:m", 0) || !allowed(l, "p:m", 0) {
+		t.Fatal("requests within the limit were delayed")
+	}
+
+	err := l.Wait(canceled(), "p:m", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the context error", err)
+	}
+	if allowed(l, "p:m", 0) {
+		t.Error("a third request in the same minute was allowed")
+	}
+	if !allowed(l, "p:other", 0) {
+		t.Error("another model shares the bucket")
+	}
+}
+
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestRateLimiterTokensPerMinute(t *testing.T) {
+	// 6000 a minute refills 100 tokens a second
+	l := NewRateLimiter(0, 6000)
+	messages := []Message{{Role: "user", Content: "abcdefgh"}} // 2 tokens of text and 4 of overhead
+	if n := EstimateMessageTokens(messages); n != 6 {
+		t.Fatalf("estimate = %d, want 6", n)
+	}
+
+	if !allowed(l, "p:m", 6000-EstimateMessageTokens(messages)) || !allowed(l, "p:m", EstimateMessageTokens(messages)) {
+		t.Fatal("requests within the limit were delayed")
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background(), "p:m", 5); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("waited %v for 5 tokens at 100 a second, want about 50ms", waited)
+	}
+}
+
+func TestRateLimiterObserve(t *testing.T) {
+	response := func(status int, headers map[string]string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		for k, v := range headers {
+			resp.Header.Set(k, v)
+		}
+		return resp
+	}
+
+	l := NewRateLimiter(1000, 100000)
+	l.Observe("p:m", response(http.StatusOK, map[string]string{
+		"x-ratelimit-remaining-requests": "0",
+		"x-ratelimit-reset-requests":     "1m",
+	}))
+	if allowed(l, "p:m", 0) {
+		t.Error("allowed a request after the server reported none remaining")
+	}
+
+	l.Observe("p:t", response(http.StatusOK, map[string]string{
+		"x-ratelimit-remaining-tokens": "10",
+		"x-ratelimit-reset-tokens":     "1m",
+	}))
+	if allowed(l, "p:t", 500) || !allowed(l, "p:t", 10) {
+		t.Error("the token bucket did not follow the remaining tokens header")
+	}
+
+	l.Observe("p:r", response(http.StatusTooManyRequests, map[string]string{"retry-after": "60"}))
+	if allowed(l, "p:r", 0) {
+		t.Error("allowed a request during retry-after")
+	}
+
+	// retry-after also applies without any configured limit
+	unlimited := NewRateLimiter(0, 0)
+	unlimited.Observe("p:r", response(http.StatusTooManyRequests, map[string]string{"retry-after": "0.05"}))
+	start := time.Now()
+	if err := unlimited.Wait(context.Background(), "p:r", 0); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Errorf("waited %v, want about the 50ms retry-after", waited)
+	}
+
+	fixed := &RateLimiter{RequestsPerMinute: 1000}
+	fixed.Observe("p:m", response(http.StatusTooManyRequests, map[string]string{"retry-after": "60"}))
+	if !allowed(fixed, "p:m", 0) {
+		t.Error("a limiter that is not adaptive followed the response headers")
+	}
+}
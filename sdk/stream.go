@@ -0,0 +1,158 @@
+// stream events and the pipe that carries them from providers to callers
+
+package sdk
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// a piece of a streamed response
+type StreamEvent struct {
+	Content   string
+	Reasoning string
+	Thinking  *ThinkingBlock   // a completed thinking block with its signature
+	ToolCall  *ToolCallRequest // a completed tool call
+	Citation  *Citation        // a completed citation
+	Safety    []SafetyRating   // the latest safety ratings, replacing earlier ones
+	Usage     *Usage
+}
+
+// implemented by streams that collect more than the content text
+type StreamResult interface {
+	Result() *CompletionResponse
+}
+
+// returns the collected result of a stream, nil if it does not collect one
+func streamResultOf(r io.Reader) *CompletionResponse {
+	if sr, ok := r.(StreamResult); ok {
+		return sr.Result()
+	}
+	return nil
+}
+
+// pipes streamed content to the reader and collects reasoning, tool calls and usage
+type EventPipe struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+
+	onReasoning func(string)
+
+	mu        sync.Mutex
+	result    CompletionResponse
+	reasoning strings.Builder
+}
+
+// creates a pipe, onReasoning is called for every reasoning chunk and may be nil
+func NewEventPipe(onReasoning func(string)) *EventPipe {
+	r, w := io.Pipe()
+	return &EventPipe{r: r, w: w, onReasoning: onReasoning, result: CompletionResponse{Role: "assistant"}}
+}
+
+func (p *EventPipe) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+func (p *EventPipe) Close() error {
+	return p.r.Close()
+}
+
+// sends one event, content is written to the reader and everything else is collected
+func (p *EventPipe) Emit(evt StreamEvent) error {
+	p.mu.Lock()
+	if evt.Content != "" {
+		p.result.Content += evt.Content
+	}
+	if evt.Reasoning != "" {
+		p.reasoning.WriteString(evt.Reasoning)
+	}
+	if evt.Thinking != nil {
+		p.result.Thinking = append(p.result.Thinking, *evt.Thinking)
+	}
+	if evt.ToolCall != nil {
+		p.result.ToolCalls = append(p.result.ToolCalls, *evt.ToolCall)
+	}
+	if evt.Citation != nil {
+		p.result.Citations = append(p.result.Citations, *evt.Citation)
+	}
+	if len(evt.Safety) > 0 {
+		p.result.Safety = evt.Safety
+	}
+	if evt.Usage != nil {
+		if p.result.Usage == nil {
+			p.result.Usage = &Usage{}
+		}
+		p.result.Usage.Add(evt.Usage)
+	}
+	p.mu.Unlock()
+
+	if evt.Reasoning != "" && p.onReasoning != nil {
+		p.onReasoning(evt.Reasoning)
+	}
+	if evt.Content != "" {
+		_, err := p.w.Write([]byte(evt.Content))
+		return err
+	}
+	return nil
+}
+
+// ends the stream, a nil error closes it with io.EOF
+func (p *EventPipe) Finish(err error) {
+	if err != nil {
+		p.w.CloseWithError(err)
+		return
+	}
+	p.w.Close()
+}
+
+// returns everything collected so far, complete once the stream has been drained
+func (p *EventPipe) Result() *CompletionResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := p.result
+	result.Reasoning = p.reasoning.String()
+	result.ToolCalls = append([]ToolCallRequest(nil), p.result.ToolCalls...)
+	result.Thinking = append([]ThinkingBlock(nil), p.result.Thinking...)
+	result.Citations = append([]Citation(nil), p.result.Citations...)
+	result.Safety = append([]SafetyRating(nil), p.result.Safety...)
+	return &result
+}
+
+// adds the non content parts of a result collected by another stream without calling callbacks
+func (p *EventPipe) merge(other *CompletionResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if other.Reasoning != "" {
+		if p.reasoning.Len() > 0 {
+			p.reasoning.WriteString("\n\n")
+		}
+		p.reasoning.WriteString(other.Reasoning)
+	}
+	p.result.Thinking = append(p.result.Thinking, other.Thinking...)
+	p.result.ToolCalls = append(p.result.ToolCalls, other.ToolCalls...)
+	p.result.Citations = append(p.result.Citations, other.Citations...)
+	if len(other.Safety) > 0 {
+		p.result.Safety = other.Safety
+	}
+	if other.Usage != nil {
+		if p.result.Usage == nil {
+			p.result.Usage = &Usage{}
+		}
+		p.result.Usage.Add(other.Usage)
+	}
+}
+
+// writes content into an event pipe
+type contentWriter struct {
+	pipe *EventPipe
+}
+
+func (w contentWriter) Write(b []byte) (int, error) {
+	if err := w.pipe.Emit(StreamEvent{Content: string(b)}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -6,20 +6,84 @@ package sdk
 import (
 	"context"
 	"encoding/json"
+	"sort"
 )
 
 type Tool struct {
-	Description string          `json:"description,omitempty"`
-	InputSchema InputSchema     `json:"inputSchema,omitempty"`
-	Execute     ToolExecuteFunc `json:"-,omitempty"`
+	Description      string          `json:"description,omitempty"`
+	InputSchema      InputSchema     `json:"inputSchema,omitempty"`
+	Execute          ToolExecuteFunc `json:"-,omitempty"`
+	CacheControl     bool            `json:"cache_control,omitempty"`     // prompt cache breakpoint after this tool, where supported
+	RequiresApproval bool            `json:"requires_approval,omitempty"` // ask the approval callback before every call
+	RawSchema        json.RawMessage `json:"raw_schema,omitempty"`        // full JSON schema of the input, sent instead of InputSchema when set
+}
+
+// returns the JSON schema of the tool input, RawSchema when set
+func (t Tool) Schema() any {
+	if len(t.RawSchema) > 0 {
+		return t.RawSchema
+	}
+	return t.InputSchema.JSONSchema()
 }
 
 type InputSchema map[string]Property
 
+// converts the input schema to a JSON schema object
+func (s InputSchema) JSONSchema() map[string]any {
+	properties := make(map[string]any, len(s))
+	required := []string{}
+
+	for name, prop := range s {
+		properties[name] = prop.JSONSchema()
+		if prop.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
 type Property struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
-	Required    bool   `json:"required,omitempty"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`       // allowed values
+	Items       *Property   `json:"items,omitempty"`      // element schema for arrays
+	Properties  InputSchema `json:"properties,omitempty"` // fields of objects
+}
+
+// converts the property to a JSON schema object
+func (p Property) JSONSchema() map[string]any {
+	def := map[string]any{"type": p.Type}
+	if p.Description != "" {
+		def["description"] = p.Description
+	}
+	if len(p.Enum) > 0 {
+		def["enum"] = p.Enum
+	}
+	if p.Type == "array" {
+		if p.Items != nil {
+			def["items"] = p.Items.JSONSchema()
+		} else {
+			def["items"] = map[string]any{}
+		}
+	}
+	if p.Type == "object" && len(p.Properties) > 0 {
+		nested := p.Properties.JSONSchema()
+		def["properties"] = nested["properties"]
+		if required, ok := nested["required"]; ok {
+			def["required"] = required
+		}
+	}
+	return def
 }
 
 type ToolExecuteFunc func(ctx context.Context, args json.RawMessage) (any, error)
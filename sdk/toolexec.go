@@ -0,0 +1,148 @@
+// executes the tool calls requested in one step of the tool loop
+
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// executes tool calls for the tool loop
+type toolRunner struct {
+	tools       map[string]Tool
+	onToolCall  func(string, json.RawMessage)
+	onApproval  ApprovalFunc
+	concurrency int
+	timeout     time.Duration
+}
+
+// asks for approval where required, then runs the approved calls with at most concurrency running at once.
+// decisions already made are read from and new ones recorded in decisions.
+// returns the tool messages in call order, or paused when any call was paused before running anything
+func (r *toolRunner) run(ctx context.Context, calls []ToolCallRequest, decisions map[string]ApprovalDecision) ([]Message, bool) {
+	results := make([]Message, len(calls))
+	approved := make([]*ToolCallRequest, len(calls))
+
+	for i, toolCall := range calls {
+		results[i] = Message{Role: "tool", ToolCallID: toolCall.ID}
+
+		tool, exists := r.tools[toolCall.Name]
+		if !exists {
+			results[i].Content = toolErrorContent(fmt.Sprintf("Tool '%s' not found", toolCall.Name))
+			continue
+		}
+
+		decision := ApprovalDecision{Action: Approve}
+		if d, ok := decisions[toolCall.ID]; ok {
+			decision = d
+		} else if tool.RequiresApproval {
+			if r.onApproval == nil {
+				decision = ApprovalDecision{Action: Deny, Reason: "tool requires approval but no approver is configured"}
+			} else {
+				decision = r.onApproval(ctx, toolCall)
+			}
+			if decision.Action != Pause {
+				decisions[toolCall.ID] = decision
+			}
+		}
+
+		switch decision.Action {
+		case Pause:
+			return nil, true
+		case Deny:
+			reason := decision.Reason
+			if reason == "" {
+				reason = "no reason given"
+			}
+			results[i].Content = toolErrorContent(fmt.Sprintf("Tool call denied by user: %s", reason))
+		default:
+			call := toolCall
+			if len(decision.Arguments) > 0 {
+				call.Arguments = decision.Arguments
+			}
+			approved[i] = &call
+		}
+	}
+
+	sem := make(chan struct{}, max(r.concurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, call := range approved {
+		if call == nil {
+			continue
+		}
+
+		// callbacks run in call order on the calling goroutine
+		if r.onToolCall != nil {
+			r.onToolCall(call.Name, call.Arguments)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, tool Tool, args json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].Content = runTool(ctx, tool, args, r.timeout)
+		}(i, r.tools[call.Name], call.Arguments)
+	}
+
+	wg.Wait()
+	return results, false
+}
+
+// runs a single tool and returns its result as message content, panics are turned into error results.
+// the tool runs on its own goroutine so a tool that ignores ctx cannot hold up the step past the timeout
+func runTool(ctx context.Context, tool Tool, args json.RawMessage, timeout time.Duration) string {
+	if tool.Execute == nil {
+		return toolErrorContent("tool has no Execute function")
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan string, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- toolErrorContent(fmt.Sprintf("tool panicked: %v", r))
+			}
+		}()
+		done <- executeTool(ctx, tool, args)
+	}()
+
+	select {
+	case content := <-done:
+		return content
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && timeout > 0 {
+			return toolErrorContent(fmt.Sprintf("tool timed out after %s", timeout))
+		}
+		return toolErrorContent(ctx.Err().Error())
+	}
+}
+
+func executeTool(ctx context.Context, tool Tool, args json.RawMessage) string {
+	result, err := tool.Execute(ctx, args)
+	if err != nil {
+		return toolErrorContent(err.Error())
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return toolErrorContent(fmt.Sprintf("Failed to marshal toolCall result: %s", err.Error()))
+	}
+	return string(resultBytes)
+}
+
+// formats a tool error as a JSON object for the model
+func toolErrorContent(msg string) string {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	return string(b)
+}
@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToolTimeoutWithToolIgnoringContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	runner := &toolRunner{
+		tools: map[string]Tool{
+			"stuck": {Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+				<-release
+				return "late", nil
+			}},
+			"quick": {Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+				return "ok", nil
+			}},
+		},
+		concurrency: 2,
+		timeout:     50 * time.Millisecond,
+	}
+
+	calls := []ToolCallRequest{{ID: "1", Name: "stuck"}, {ID: "2", Name: "quick"}}
+	finished := make(chan []Message, 1)
+	go func() {
+		results, _ := runner.run(context.Background(), calls, map[string]ApprovalDecision{})
+		finished <- results
+	}()
+
+	select {
+	case results := <-finished:
+		if !strings.Contains(results[0].Content, "timed out") {
+			t.Errorf("stuck tool result = %s", results[0].Content)
+		}
+		if results[1].Content != `"ok"` {
+			t.Errorf("quick tool result = %s", results[1].Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("step did not finish after the tool timeout")
+	}
+}
+
+func TestToolPanicBecomesErrorResult(t *testing.T) {
+	tool := Tool{Execute: func(ctx context.Context, args json.RawMessage) (any, error) {
+		panic("boom")
+	}}
+	if content := runTool(context.Background(), tool, nil, 0); !strings.Contains(content, "tool panicked: boom") {
+		t.Errorf("content = %s", content)
+	}
+}